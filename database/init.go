@@ -35,13 +35,23 @@ func InitDB() (*gorm.DB, error) {
 
 	err = db.AutoMigrate(
 		&model.User{},
+		&model.Category{},
 		&model.RegularExpense{},
+		&model.AmountChange{},
 		&model.Expense{},
+		&model.Budget{},
+		&model.JobRun{},
+		&model.Notification{},
+		&model.ExchangeRate{},
 	)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to auto migrate tables: %w", err)
 	}
 
+	if err := applyMigrations(db); err != nil {
+		return nil, fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
 	return db, nil
 }
@@ -0,0 +1,241 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/recurrence"
+	"gorm.io/gorm"
+)
+
+// migrationsLockID is the key of the advisory lock that keeps replicas
+// starting at the same time from applying a migration twice.
+const migrationsLockID = 7262001
+
+type schemaMigration struct {
+	Name      string    `gorm:"primaryKey;size:100"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+type migration struct {
+	name string
+	run  func(tx *gorm.DB) error
+}
+
+// migrations change existing data after AutoMigrate has brought the schema up
+// to date. Each one is applied exactly once, in order. Never edit or reorder
+// an applied migration, append a new one instead.
+var migrations = []migration{
+	{"0001_snapshot_expense_amounts", snapshotExpenseAmounts},
+	{"0002_amounts_to_minor_units", amountsToMinorUnits},
+	{"0003_frequency_to_recurrence", frequencyToRecurrence},
+	{"0004_count_paid_occurrences", countPaidOccurrences},
+	{"0005_regular_expense_status", regularExpenseStatus},
+	{"0006_expense_categories", expenseCategories},
+}
+
+func applyMigrations(db *gorm.DB) error {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration runs m unless it has been applied before, and records it.
+func applyMigration(db *gorm.DB, m migration) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationsLockID).Error; err != nil {
+			return err
+		}
+
+		var applied int64
+		if err := tx.Model(&schemaMigration{}).Where("name = ?", m.name).Count(&applied).Error; err != nil {
+			return err
+		}
+
+		if applied > 0 {
+			return nil
+		}
+
+		if err := m.run(tx); err != nil {
+			return err
+		}
+
+		return tx.Create(&schemaMigration{Name: m.name, AppliedAt: time.Now()}).Error
+	})
+}
+
+// snapshotExpenseAmounts copies the name and amount of their regular expense
+// onto the expenses recorded before expenses had their own. The amount in
+// effect when they were paid is not known any more, the current one is the
+// best guess. One-off expenses are left alone.
+func snapshotExpenseAmounts(tx *gorm.DB) error {
+	return tx.Exec(
+		`UPDATE expenses SET name = re.name, amount = re.amount, currency = 'RUB'
+		FROM regular_expenses re
+		WHERE expenses.regular_expense_id = re.id`,
+	).Error
+}
+
+// amountsToMinorUnits rescales amounts stored in whole currency units into
+// minor units. Pending amount changes are in the currency of their regular
+// expense.
+func amountsToMinorUnits(tx *gorm.DB) error {
+	for _, code := range model.SupportedCurrencies {
+		scale := 1
+		for i := 0; i < model.CurrencyExponent(code); i++ {
+			scale *= 10
+		}
+
+		if scale == 1 {
+			continue
+		}
+
+		statements := []string{
+			`UPDATE regular_expenses SET amount = amount * ? WHERE currency = ?`,
+			`UPDATE expenses SET amount = amount * ? WHERE currency = ?`,
+			`UPDATE amount_changes SET amount = amount_changes.amount * ?
+			FROM regular_expenses re
+			WHERE amount_changes.regular_expense_id = re.id AND re.currency = ?`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement, scale, code).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// frequencyToRecurrence replaces the interval column frequency with an
+// equivalent recurrence rule anchored at the current next date. Monthly and
+// yearly intervals clamp to the end of short months, as adding an interval in
+// Postgres did, but no longer drift to the 28th afterwards.
+func frequencyToRecurrence(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn("regular_expenses", "frequency") {
+		return nil
+	}
+
+	var rows []struct {
+		ID     uint64
+		Months int
+		Days   int
+	}
+	err := tx.Raw(
+		`SELECT id,
+			EXTRACT(YEAR FROM frequency)::int * 12 + EXTRACT(MONTH FROM frequency)::int AS months,
+			EXTRACT(DAY FROM frequency)::int AS days
+		FROM regular_expenses WHERE frequency IS NOT NULL`,
+	).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		rule, ok := intervalRule(row.Months, row.Days)
+		if !ok {
+			// Such intervals never produced a payment, the rule keeps its
+			// default.
+			continue
+		}
+
+		err := tx.Exec("UPDATE regular_expenses SET recurrence = ? WHERE id = ?", rule.String(), row.ID).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Exec("UPDATE regular_expenses SET start_date = next_date WHERE start_date IS NULL").Error; err != nil {
+		return err
+	}
+
+	return tx.Migrator().DropColumn("regular_expenses", "frequency")
+}
+
+// intervalRule converts an interval of months and days into a rule. Days are
+// dropped from intervals that have both.
+func intervalRule(months, days int) (recurrence.Rule, bool) {
+	switch {
+	case months > 0 && months%12 == 0:
+		return recurrence.Rule{Freq: recurrence.Yearly, Interval: months / 12, Skip: recurrence.Backward}, true
+	case months > 0:
+		return recurrence.Rule{Freq: recurrence.Monthly, Interval: months, Skip: recurrence.Backward}, true
+	case days > 0 && days%7 == 0:
+		return recurrence.Rule{Freq: recurrence.Weekly, Interval: days / 7}, true
+	case days > 0:
+		return recurrence.Rule{Freq: recurrence.Daily, Interval: days}, true
+	default:
+		return recurrence.Rule{}, false
+	}
+}
+
+// countPaidOccurrences sets occurrence_count from the expenses already
+// recorded for each regular expense.
+func countPaidOccurrences(tx *gorm.DB) error {
+	return tx.Exec(
+		`UPDATE regular_expenses SET occurrence_count = (
+			SELECT COUNT(*) FROM expenses WHERE expenses.regular_expense_id = regular_expenses.id
+		)`,
+	).Error
+}
+
+// regularExpenseStatus derives the status of regular expenses that were
+// stopped by clearing next_date. Those that reached their limits have ended,
+// the rest were deleted by their owner. When they were deleted is unknown, so
+// cancelled_at stays empty.
+func regularExpenseStatus(tx *gorm.DB) error {
+	return tx.Exec(
+		`UPDATE regular_expenses SET status = CASE
+			WHEN max_occurrences IS NOT NULL AND occurrence_count >= max_occurrences THEN ?
+			WHEN end_date IS NOT NULL AND end_date < CURRENT_DATE THEN ?
+			ELSE ?
+		END
+		WHERE next_date IS NULL`,
+		model.RegularExpenseEnded, model.RegularExpenseEnded, model.RegularExpenseCancelled,
+	).Error
+}
+
+// expenseCategories gives existing users the default categories and turns the
+// free-text category of one-off expenses into a reference to a category of
+// the same name, creating it when needed.
+func expenseCategories(tx *gorm.DB) error {
+	for _, name := range model.DefaultCategories {
+		err := tx.Exec(
+			`INSERT INTO categories (user_id, name) SELECT id, ? FROM users
+			ON CONFLICT DO NOTHING`,
+			name,
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if !tx.Migrator().HasColumn("expenses", "category") {
+		return nil
+	}
+
+	statements := []string{
+		`UPDATE expenses SET category = TRIM(category) WHERE category IS NOT NULL`,
+		`INSERT INTO categories (user_id, name)
+		SELECT DISTINCT user_id, category FROM expenses WHERE category IS NOT NULL AND category <> ''
+		ON CONFLICT DO NOTHING`,
+		`UPDATE expenses SET category_id = c.id FROM categories c
+		WHERE c.user_id = expenses.user_id AND c.name = expenses.category`,
+	}
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Migrator().DropColumn("expenses", "category")
+}
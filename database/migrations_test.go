@@ -0,0 +1,66 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func initTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { mockDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: mockDB, DriverName: "postgres"}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+
+	return db, mock
+}
+
+func TestSnapshotExpenseAmounts(t *testing.T) {
+	db, mock := initTestDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\)`).
+		WithArgs(migrationsLockID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "schema_migrations" WHERE name = \$1`).
+		WithArgs("0001_snapshot_expense_amounts").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	// Only expenses paid for a regular expense get its name and amount.
+	mock.ExpectExec(`UPDATE expenses SET name = re.name, amount = re.amount, currency = 'RUB'\s+` +
+		`FROM regular_expenses re\s+WHERE expenses.regular_expense_id = re.id`).
+		WillReturnResult(sqlmock.NewResult(0, 12))
+	mock.ExpectExec(`INSERT INTO "schema_migrations" \("name","applied_at"\) VALUES \(\$1,\$2\)`).
+		WithArgs("0001_snapshot_expense_amounts", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, applyMigration(db, migrations[0]))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppliedMigrationIsNotRunAgain(t *testing.T) {
+	db, mock := initTestDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\)`).
+		WithArgs(migrationsLockID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "schema_migrations" WHERE name = \$1`).
+		WithArgs("0001_snapshot_expense_amounts").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectCommit()
+
+	// Running the snapshot again would overwrite amounts recorded since.
+	assert.NoError(t, applyMigration(db, migrations[0]))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoadExchangeRates reads exchange rates from CSV with the header
+// "date,from,to,rate", where rate is the price of one unit of the "from"
+// currency in the "to" currency, and stores them, replacing rates already
+// known for the same date and pair. It returns the number of rates loaded.
+func LoadExchangeRates(db *gorm.DB, r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if strings.Join(header, ",") != "date,from,to,rate" {
+		return 0, errors.New(`header should be "date,from,to,rate"`)
+	}
+
+	var rates []model.ExchangeRate
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		rate, err := parseExchangeRate(record)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		rates = append(rates, rate)
+	}
+
+	if len(rates) == 0 {
+		return 0, nil
+	}
+
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}, {Name: "from_currency"}, {Name: "to_currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate"}),
+	}).CreateInBatches(&rates, 500).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return len(rates), nil
+}
+
+func parseExchangeRate(record []string) (model.ExchangeRate, error) {
+	date, err := time.Parse(time.DateOnly, record[0])
+	if err != nil {
+		return model.ExchangeRate{}, fmt.Errorf("invalid date %q", record[0])
+	}
+
+	from, to := strings.ToUpper(record[1]), strings.ToUpper(record[2])
+	if !model.IsSupportedCurrency(from) || !model.IsSupportedCurrency(to) || from == to {
+		return model.ExchangeRate{}, fmt.Errorf("invalid currency pair %s/%s", record[1], record[2])
+	}
+
+	rate, err := strconv.ParseFloat(record[3], 64)
+	if err != nil || rate <= 0 {
+		return model.ExchangeRate{}, fmt.Errorf("invalid rate %q", record[3])
+	}
+
+	return model.ExchangeRate{
+		Date:         date.Format(time.DateOnly),
+		FromCurrency: from,
+		ToCurrency:   to,
+		Rate:         rate,
+	}, nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadExchangeRates(t *testing.T) {
+	db, mock := initTestDB(t)
+
+	// A rate loaded again for the same date and pair replaces the old one.
+	mock.ExpectExec(`INSERT INTO "exchange_rates" \("date","from_currency","to_currency","rate"\) VALUES \(\$1,\$2,\$3,\$4\),\(\$5,\$6,\$7,\$8\) `+
+		`ON CONFLICT \("date","from_currency","to_currency"\) DO UPDATE SET "rate"="excluded"."rate"`).
+		WithArgs("2026-01-01", "USD", "RUB", 92.5, "2026-01-02", "EUR", "RUB", 100.25).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	csv := "date,from,to,rate\n2026-01-01,usd,rub,92.5\n2026-01-02, EUR, RUB, 100.25\n"
+	count, err := LoadExchangeRates(db, strings.NewReader(csv))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadExchangeRatesRejectsInvalidFiles(t *testing.T) {
+	table := []struct {
+		name  string
+		csv   string
+		error string
+	}{
+		{"empty file", "", "failed to read header"},
+		{"wrong header", "day,from,to,rate\n", `header should be "date,from,to,rate"`},
+		{"invalid date", "date,from,to,rate\n2026-01-01,USD,RUB,92.5\n01.02.2026,USD,RUB,93\n", `line 3: invalid date "01.02.2026"`},
+		{"unknown currency", "date,from,to,rate\n2026-01-01,USD,XXX,1\n", "line 2: invalid currency pair USD/XXX"},
+		{"same currency", "date,from,to,rate\n2026-01-01,USD,usd,1\n", "line 2: invalid currency pair USD/usd"},
+		{"negative rate", "date,from,to,rate\n2026-01-01,USD,RUB,-92.5\n", `line 2: invalid rate "-92.5"`},
+		{"missing column", "date,from,to,rate\n2026-01-01,USD,RUB\n", "wrong number of fields"},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			db, mock := initTestDB(t)
+
+			// Nothing is stored unless the whole file is valid.
+			_, err := LoadExchangeRates(db, strings.NewReader(params.csv))
+
+			assert.ErrorContains(t, err, params.error)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestLoadExchangeRatesWithoutRates(t *testing.T) {
+	db, mock := initTestDB(t)
+
+	count, err := LoadExchangeRates(db, strings.NewReader("date,from,to,rate\n"))
+
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
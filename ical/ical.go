@@ -0,0 +1,120 @@
+// Package ical writes iCalendar (RFC 5545) files with all-day events, which
+// is how payments of regular expenses are put into calendars.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineLength is the length in octets after which content lines are
+// folded, not counting the line break.
+const maxLineLength = 75
+
+// Calendar is a VCALENDAR object.
+type Calendar struct {
+	ProdID string
+	// Name is shown by calendar applications as the name of a subscribed
+	// calendar.
+	Name   string
+	Events []Event
+}
+
+// Event is an all-day VEVENT.
+type Event struct {
+	// UID must stay the same for the same event across exports, so that
+	// importing or polling the calendar again updates it in place.
+	UID         string
+	Date        time.Time
+	Summary     string
+	Description string
+	// Alarms are the days before Date at which the event is to be reminded
+	// of, 0 meaning the day itself.
+	Alarms []int
+}
+
+// Write writes c to w. Stamp is used as the DTSTAMP of every event.
+func (c Calendar) Write(w io.Writer, stamp time.Time) error {
+	b := bufio.NewWriter(w)
+
+	line := func(name, value string) {
+		writeFolded(b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", escape(c.ProdID))
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(e.UID))
+		line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+		line("DTSTART;VALUE=DATE", e.Date.Format("20060102"))
+		line("DTEND;VALUE=DATE", e.Date.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		line("TRANSP", "TRANSPARENT")
+
+		for _, days := range e.Alarms {
+			line("BEGIN", "VALARM")
+			line("ACTION", "DISPLAY")
+			line("DESCRIPTION", escape(e.Summary))
+			line("TRIGGER", trigger(days))
+			line("END", "VALARM")
+		}
+
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return b.Flush()
+}
+
+// trigger is the TRIGGER of an alarm days before the start of an event.
+func trigger(days int) string {
+	if days == 0 {
+		return "PT0S"
+	}
+	return fmt.Sprintf("-P%dD", days)
+}
+
+// escape escapes a TEXT value.
+func escape(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(value)
+}
+
+// writeFolded writes a content line, folding it into lines of at most
+// maxLineLength octets without splitting UTF-8 sequences.
+func writeFolded(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts.
+		limit = maxLineLength - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
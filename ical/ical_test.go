@@ -0,0 +1,73 @@
+package ical_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/ical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	calendar := ical.Calendar{
+		ProdID: "-//vct-project//Regular Expenses Tracker//EN",
+		Name:   "Regular payments",
+		Events: []ical.Event{{
+			UID:         "7-2026-02-01@vct-project",
+			Date:        time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC),
+			Summary:     "Rent, flat; 300.00 ₽",
+			Description: "Monthly\nlast payment",
+			Alarms:      []int{3, 0},
+		}},
+	}
+
+	var b strings.Builder
+	require.NoError(t, calendar.Write(&b, time.Date(2026, time.January, 10, 12, 30, 0, 0, time.UTC)))
+
+	assert.Equal(t, strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//vct-project//Regular Expenses Tracker//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:Regular payments",
+		"BEGIN:VEVENT",
+		"UID:7-2026-02-01@vct-project",
+		"DTSTAMP:20260110T123000Z",
+		"DTSTART;VALUE=DATE:20260201",
+		"DTEND;VALUE=DATE:20260202",
+		`SUMMARY:Rent\, flat\; 300.00 ₽`,
+		`DESCRIPTION:Monthly\nlast payment`,
+		"TRANSP:TRANSPARENT",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		`DESCRIPTION:Rent\, flat\; 300.00 ₽`,
+		"TRIGGER:-P3D",
+		"END:VALARM",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		`DESCRIPTION:Rent\, flat\; 300.00 ₽`,
+		"TRIGGER:PT0S",
+		"END:VALARM",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n"), b.String())
+}
+
+func TestLongLinesAreFolded(t *testing.T) {
+	calendar := ical.Calendar{
+		ProdID: "test",
+		Events: []ical.Event{{UID: "1", Summary: strings.Repeat("Подписка ", 20)}},
+	}
+
+	var b strings.Builder
+	require.NoError(t, calendar.Write(&b, time.Now()))
+
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, line)
+	}
+	assert.Contains(t, strings.ReplaceAll(b.String(), "\r\n ", ""), "SUMMARY:"+strings.Repeat("Подписка ", 20)+"\r\n")
+}
@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DateFormats are the date formats CSV files can use, by the name shown to
+// users.
+var DateFormats = map[string]string{
+	"YYYY-MM-DD": time.DateOnly,
+	"DD.MM.YYYY": "02.01.2006",
+	"DD/MM/YYYY": "02/01/2006",
+	"MM/DD/YYYY": "01/02/2006",
+}
+
+// CSVMapping says where the fields of a transaction are in a CSV file. The
+// first row of the file names the columns.
+type CSVMapping struct {
+	Date   string
+	Amount string
+	Payee  string
+	// Currency is the column with currency codes, if the file has one.
+	// Otherwise every row is in DefaultCurrency.
+	Currency        string
+	DefaultCurrency string
+	// DateFormat is a key of DateFormats, YYYY-MM-DD by default.
+	DateFormat string
+	// Comma separates the fields, ',' by default.
+	Comma rune
+	// PositiveSpending is set for exports that list spending as positive
+	// amounts. By default, as in bank statements, spending is negative and
+	// rows with positive amounts are skipped as incoming payments.
+	PositiveSpending bool
+}
+
+// ParseCSV reads the transactions of a CSV file according to mapping. Rows
+// with an invalid date, currency or amount are skipped and returned as row
+// errors.
+func ParseCSV(r io.Reader, mapping CSVMapping) ([]Transaction, []RowError, error) {
+	layout := time.DateOnly
+	if mapping.DateFormat != "" {
+		var ok bool
+		if layout, ok = DateFormats[mapping.DateFormat]; !ok {
+			return nil, nil, fmt.Errorf("unknown date format %q", mapping.DateFormat)
+		}
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if mapping.Comma != 0 {
+		reader.Comma = mapping.Comma
+	}
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	column := func(name string, required bool) (int, error) {
+		if name == "" && !required {
+			return -1, nil
+		}
+		i := slices.IndexFunc(header, func(title string) bool {
+			return strings.EqualFold(strings.TrimSpace(title), strings.TrimSpace(name))
+		})
+		if i < 0 {
+			return -1, fmt.Errorf("column %q not found", name)
+		}
+		return i, nil
+	}
+
+	dateColumn, err := column(mapping.Date, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	amountColumn, err := column(mapping.Amount, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	payeeColumn, err := column(mapping.Payee, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	currencyColumn, err := column(mapping.Currency, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		transactions []Transaction
+		rowErrors    []RowError
+	)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		field := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		skip := func(message string) {
+			rowErrors = append(rowErrors, RowError{Row: fmt.Sprintf("line %d", line), Message: message})
+		}
+
+		date, err := time.Parse(layout, field(dateColumn))
+		if err != nil {
+			skip(fmt.Sprintf("invalid date %q", field(dateColumn)))
+			continue
+		}
+
+		currency := mapping.DefaultCurrency
+		if value := field(currencyColumn); value != "" {
+			if currency, err = parseCurrency(value); err != nil {
+				skip(err.Error())
+				continue
+			}
+		}
+
+		amount, negative, err := parseAmount(field(amountColumn), currency)
+		if err != nil {
+			skip(err.Error())
+			continue
+		}
+		if amount.Minor == 0 || negative == mapping.PositiveSpending {
+			continue
+		}
+
+		transactions = append(transactions, Transaction{
+			Date:   date.Format(time.DateOnly),
+			Payee:  truncatePayee(field(payeeColumn)),
+			Amount: amount,
+		})
+	}
+
+	return transactions, rowErrors, nil
+}
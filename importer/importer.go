@@ -0,0 +1,127 @@
+// Package importer reads bank statements and spending exports, CSV files
+// with a user-provided column mapping and OFX statements, into transactions
+// that can be recorded as expenses. It also finds charges that repeat
+// regularly and are likely to be subscriptions.
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sergeykhargelia/vct-project/model"
+)
+
+// Transaction is money spent according to a statement. Amount is always
+// positive: incoming payments and refunds are not transactions.
+type Transaction struct {
+	Date   string
+	Payee  string
+	Amount model.Money
+	// ID identifies the transaction within its source when the source has
+	// such ids, like the FITID of OFX statements.
+	ID string
+}
+
+// Keys returns a key for every transaction that stays the same when the same
+// statement, or a statement overlapping it, is imported again. Transactions
+// without an ID are told apart by their contents, and identical ones within
+// one statement by how many came before them.
+func Keys(transactions []Transaction) []string {
+	keys := make([]string, len(transactions))
+	seen := map[string]int{}
+	for i, t := range transactions {
+		source := "id:" + t.ID
+		if t.ID == "" {
+			content := fmt.Sprintf("%s|%d|%s|%s", t.Date, t.Amount.Minor, t.Amount.Currency, NormalizePayee(t.Payee))
+			source = fmt.Sprintf("row:%s|%d", content, seen[content])
+			seen[content]++
+		}
+
+		sum := sha256.Sum256([]byte(source))
+		keys[i] = hex.EncodeToString(sum[:])
+	}
+	return keys
+}
+
+// RowError is a row of a statement that could not be read: a line of a CSV
+// file or a transaction of an OFX statement. The rest of the statement is
+// read without it.
+type RowError struct {
+	Row     string
+	Message string
+}
+
+// NormalizePayee reduces a payee to the form in which charges of one
+// merchant compare equal: lowercase, without card numbers, references and
+// other words containing digits, and with single spaces.
+func NormalizePayee(payee string) string {
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(payee)) {
+		if !strings.ContainsAny(word, "0123456789#*") {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// parseAmount parses a signed decimal amount as written in statements, e.g.
+// "-1 234,56", "1,234.56" or "(15.00)". It returns the absolute amount and
+// whether it was negative, which for statements means money leaving the
+// account.
+func parseAmount(value, currency string) (model.Money, bool, error) {
+	value = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", "\u2212", "-").Replace(strings.TrimSpace(value))
+
+	negative := false
+	switch {
+	case strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")"):
+		negative, value = true, value[1:len(value)-1]
+	case strings.HasPrefix(value, "-"):
+		negative, value = true, value[1:]
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	}
+
+	// With both separators present the first one groups thousands. So does
+	// a separator that appears more than once, and a single comma followed
+	// by three digits, as in 1,234.
+	dot, comma := strings.LastIndex(value, "."), strings.LastIndex(value, ",")
+	switch {
+	case dot >= 0 && comma >= 0:
+		if dot > comma {
+			value = strings.ReplaceAll(value, ",", "")
+		} else {
+			value = strings.ReplaceAll(value, ".", "")
+		}
+	case comma >= 0 && (strings.Count(value, ",") > 1 || len(value)-comma == 4):
+		value = strings.ReplaceAll(value, ",", "")
+	case strings.Count(value, ".") > 1:
+		value = strings.ReplaceAll(value, ".", "")
+	}
+
+	amount, err := model.ParseMoney(value, currency)
+	if err != nil {
+		return model.Money{}, false, err
+	}
+	return amount, negative, nil
+}
+
+// parseCurrency checks a currency code found in a statement.
+func parseCurrency(value string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(value))
+	if !model.IsSupportedCurrency(code) {
+		return "", errors.New("unsupported currency " + value)
+	}
+	return code, nil
+}
+
+// truncatePayee shortens a payee to fit the name of an expense.
+func truncatePayee(payee string) string {
+	payee = strings.Join(strings.Fields(payee), " ")
+	if runes := []rune(payee); len(runes) > 50 {
+		return string(runes[:50])
+	}
+	return payee
+}
@@ -0,0 +1,256 @@
+package importer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sergeykhargelia/vct-project/importer"
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCSV(t *testing.T) {
+	file := "\ufeffДата;Сумма;Описание;Валюта\n" +
+		"15.01.2026;-1 299,00;NETFLIX.COM 4821;RUB\n" +
+		"16.01.2026;50 000,00;Salary;RUB\n" +
+		"17.01.2026;-12,5;Coffee;EUR\n" +
+		";;;\n"
+
+	transactions, rowErrors, err := importer.ParseCSV(strings.NewReader(file), importer.CSVMapping{
+		Date:            "Дата",
+		Amount:          "сумма",
+		Payee:           "Описание",
+		Currency:        "Валюта",
+		DefaultCurrency: "RUB",
+		DateFormat:      "DD.MM.YYYY",
+		Comma:           ';',
+	})
+	require.NoError(t, err)
+	assert.Empty(t, rowErrors)
+
+	assert.Equal(t, []importer.Transaction{
+		{Date: "2026-01-15", Payee: "NETFLIX.COM 4821", Amount: model.Money{Minor: 129900, Currency: "RUB"}},
+		{Date: "2026-01-17", Payee: "Coffee", Amount: model.Money{Minor: 1250, Currency: "EUR"}},
+	}, transactions)
+}
+
+func TestParseCSVPositiveSpending(t *testing.T) {
+	file := "date,amount,merchant\n2026-01-15,\"1,234.50\",Rent\n2026-01-16,-20,Refund\n"
+
+	transactions, _, err := importer.ParseCSV(strings.NewReader(file), importer.CSVMapping{
+		Date:             "date",
+		Amount:           "amount",
+		Payee:            "merchant",
+		DefaultCurrency:  "USD",
+		PositiveSpending: true,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []importer.Transaction{
+		{Date: "2026-01-15", Payee: "Rent", Amount: model.Money{Minor: 123450, Currency: "USD"}},
+	}, transactions)
+}
+
+func TestParseCSVThousandsSeparators(t *testing.T) {
+	file := "date;amount;payee;currency\n" +
+		"2026-01-15;-1,234;Laptop;JPY\n" +
+		"2026-01-16;-1 234,00;Phone;RUB\n" +
+		"2026-01-17;-1,234,567;Car;JPY\n" +
+		"2026-01-18;-1.234.567,89;House;RUB\n" +
+		"2026-01-19;-12,50;Lunch;EUR\n"
+
+	transactions, rowErrors, err := importer.ParseCSV(strings.NewReader(file), importer.CSVMapping{
+		Date:     "date",
+		Amount:   "amount",
+		Payee:    "payee",
+		Currency: "currency",
+		Comma:    ';',
+	})
+	require.NoError(t, err)
+	assert.Empty(t, rowErrors)
+
+	assert.Equal(t, []importer.Transaction{
+		{Date: "2026-01-15", Payee: "Laptop", Amount: model.Money{Minor: 1234, Currency: "JPY"}},
+		{Date: "2026-01-16", Payee: "Phone", Amount: model.Money{Minor: 123400, Currency: "RUB"}},
+		{Date: "2026-01-17", Payee: "Car", Amount: model.Money{Minor: 1234567, Currency: "JPY"}},
+		{Date: "2026-01-18", Payee: "House", Amount: model.Money{Minor: 123456789, Currency: "RUB"}},
+		{Date: "2026-01-19", Payee: "Lunch", Amount: model.Money{Minor: 1250, Currency: "EUR"}},
+	}, transactions)
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	mapping := importer.CSVMapping{Date: "date", Amount: "amount", Payee: "payee", DefaultCurrency: "RUB"}
+
+	table := []struct {
+		file string
+		err  string
+	}{
+		{"", "file is empty"},
+		{"date,sum,payee\n", `column "amount" not found`},
+	}
+
+	for _, params := range table {
+		_, _, err := importer.ParseCSV(strings.NewReader(params.file), mapping)
+		if assert.Error(t, err, params.file) {
+			assert.Contains(t, err.Error(), params.err)
+		}
+	}
+}
+
+func TestParseCSVSkipsInvalidRows(t *testing.T) {
+	file := "date,amount,payee,currency\n" +
+		"2026-13-01,-1,Shop,\n" +
+		"2026-01-02,-1.234,Shop,\n" +
+		"2026-01-03,-5,Shop,XYZ\n" +
+		"2026-01-04,-10,Bakery,\n"
+
+	transactions, rowErrors, err := importer.ParseCSV(strings.NewReader(file), importer.CSVMapping{
+		Date:            "date",
+		Amount:          "amount",
+		Payee:           "payee",
+		Currency:        "currency",
+		DefaultCurrency: "RUB",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []importer.Transaction{
+		{Date: "2026-01-04", Payee: "Bakery", Amount: model.Money{Minor: 1000, Currency: "RUB"}},
+	}, transactions)
+	if assert.Len(t, rowErrors, 3) {
+		assert.Equal(t, importer.RowError{Row: "line 2", Message: `invalid date "2026-13-01"`}, rowErrors[0])
+		assert.Equal(t, "line 3", rowErrors[1].Row)
+		assert.Equal(t, importer.RowError{Row: "line 4", Message: "unsupported currency XYZ"}, rowErrors[2])
+	}
+}
+
+// sgmlStatement is an OFX 1.x statement, with unclosed elements.
+const sgmlStatement = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>USD
+<BANKACCTFROM><BANKID>123<ACCTID>0042<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20260105120000.000[-5:EST]
+<TRNAMT>-15.99
+<FITID>A1
+<NAME>Spotify &amp; Co
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20260106
+<TRNAMT>1000.00
+<FITID>A2
+<NAME>Payroll
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20260107
+<TRNAMT>-3.50
+<FITID>A3
+<MEMO>Parking
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFX(t *testing.T) {
+	transactions, rowErrors, err := importer.ParseOFX(strings.NewReader(sgmlStatement))
+	require.NoError(t, err)
+	assert.Empty(t, rowErrors)
+
+	assert.Equal(t, []importer.Transaction{
+		{Date: "2026-01-05", Payee: "Spotify & Co", Amount: model.Money{Minor: 1599, Currency: "USD"}, ID: "ofx:0042:A1"},
+		{Date: "2026-01-07", Payee: "Parking", Amount: model.Money{Minor: 350, Currency: "USD"}, ID: "ofx:0042:A3"},
+	}, transactions)
+}
+
+func TestParseOFXVersion2(t *testing.T) {
+	statement := `<?xml version="1.0"?><?OFX OFXHEADER="200" VERSION="220"?>
+<OFX><CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS><CURDEF>EUR</CURDEF>
+<CCACCTFROM><ACCTID>9</ACCTID></CCACCTFROM><BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20260110</DTPOSTED><TRNAMT>-9.99</TRNAMT><FITID>X</FITID>
+<NAME>Cloud</NAME><PAYEE><NAME>Cloud Storage Inc</NAME></PAYEE></STMTTRN>
+</BANKTRANLIST></CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1></OFX>`
+
+	transactions, _, err := importer.ParseOFX(strings.NewReader(statement))
+	require.NoError(t, err)
+
+	assert.Equal(t, []importer.Transaction{
+		{Date: "2026-01-10", Payee: "Cloud", Amount: model.Money{Minor: 999, Currency: "EUR"}, ID: "ofx:9:X"},
+	}, transactions)
+
+	_, _, err = importer.ParseOFX(strings.NewReader("date,amount\n"))
+	assert.Error(t, err)
+}
+
+func TestParseOFXSkipsInvalidTransactions(t *testing.T) {
+	statement := strings.Replace(sgmlStatement, "<DTPOSTED>20260107", "<DTPOSTED>2026", 1)
+
+	transactions, rowErrors, err := importer.ParseOFX(strings.NewReader(statement))
+	require.NoError(t, err)
+
+	assert.Equal(t, []importer.Transaction{
+		{Date: "2026-01-05", Payee: "Spotify & Co", Amount: model.Money{Minor: 1599, Currency: "USD"}, ID: "ofx:0042:A1"},
+	}, transactions)
+	assert.Equal(t, []importer.RowError{
+		{Row: `transaction "A3"`, Message: `invalid posting date "2026"`},
+	}, rowErrors)
+}
+
+func TestKeys(t *testing.T) {
+	coffee := importer.Transaction{Date: "2026-01-01", Payee: "Coffee", Amount: model.Money{Minor: 300, Currency: "RUB"}}
+	tea := importer.Transaction{Date: "2026-01-01", Payee: "Tea", Amount: model.Money{Minor: 300, Currency: "RUB"}}
+
+	first := importer.Keys([]importer.Transaction{coffee, coffee, tea})
+	again := importer.Keys([]importer.Transaction{tea, coffee, coffee, coffee})
+
+	assert.Len(t, first[0], 64)
+	assert.NotEqual(t, first[0], first[1], "identical rows of one file are kept apart")
+	assert.Equal(t, first[0], again[1])
+	assert.Equal(t, first[1], again[2])
+	assert.Equal(t, first[2], again[0])
+	assert.NotContains(t, first, again[3])
+
+	withID := importer.Keys([]importer.Transaction{{ID: "ofx:1:A", Date: "2026-01-01"}, {ID: "ofx:1:A", Date: "2026-01-02"}})
+	assert.Equal(t, withID[0], withID[1])
+}
+
+func TestSuggestRecurring(t *testing.T) {
+	charge := func(date, payee string, minor int64) importer.Transaction {
+		return importer.Transaction{Date: date, Payee: payee, Amount: model.Money{Minor: minor, Currency: "RUB"}}
+	}
+
+	transactions := []importer.Transaction{
+		charge("2026-01-31", "NETFLIX.COM 1111", 79900),
+		charge("2026-02-28", "Netflix.com 2222", 79900),
+		charge("2026-03-31", "NETFLIX.COM 3333", 89900),
+		charge("2026-01-05", "Gym", 200000),
+		charge("2026-01-12", "Gym", 200000),
+		charge("2026-01-19", "Gym", 200000),
+		charge("2026-01-03", "Groceries", 150000),
+		charge("2026-01-09", "Groceries", 80000),
+		charge("2026-01-20", "Groceries", 120000),
+		charge("2026-01-01", "Taxi", 50000),
+		charge("2026-02-01", "Taxi", 50000),
+	}
+
+	suggestions := importer.SuggestRecurring(transactions, "2026-04-15")
+
+	assert.Equal(t, []importer.Suggestion{
+		{
+			Name: "Gym", Amount: model.Money{Minor: 200000, Currency: "RUB"}, Recurrence: "FREQ=WEEKLY",
+			Count: 3, LastDate: "2026-01-19", NextDate: "2026-04-20",
+		},
+		{
+			Name: "NETFLIX.COM 3333", Amount: model.Money{Minor: 89900, Currency: "RUB"}, Recurrence: "FREQ=MONTHLY;SKIP=BACKWARD",
+			Count: 3, LastDate: "2026-03-31", NextDate: "2026-04-30",
+		},
+	}, suggestions)
+}
@@ -0,0 +1,133 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxOFXSize bounds how much of a statement ParseOFX reads.
+const maxOFXSize = 10 << 20
+
+// ParseOFX reads the debits of an OFX bank or credit card statement. Both the
+// SGML syntax of OFX 1.x, where elements are not closed, and the XML syntax
+// of OFX 2.x are accepted. Amounts are in the CURDEF currency of their
+// statement, and transactions are identified by account and FITID.
+// Transactions that cannot be read are skipped and returned as row errors.
+func ParseOFX(r io.Reader) ([]Transaction, []RowError, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxOFXSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := bytes.Index(bytes.ToUpper(data), []byte("<OFX>"))
+	if start < 0 {
+		return nil, nil, errors.New("not an OFX statement")
+	}
+
+	var (
+		transactions []Transaction
+		rowErrors    []RowError
+		currency     string
+		account      string
+		current      map[string]string
+	)
+
+	rest := string(data[start:])
+	for {
+		open := strings.IndexByte(rest, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[open:], '>')
+		if end < 0 {
+			break
+		}
+
+		tag := strings.ToUpper(strings.TrimSpace(rest[open+1 : open+end]))
+		rest = rest[open+end+1:]
+
+		value := rest
+		if next := strings.IndexByte(rest, '<'); next >= 0 {
+			value = rest[:next]
+		}
+		value = html.UnescapeString(strings.TrimSpace(value))
+
+		switch tag {
+		case "CURDEF":
+			currency = value
+		case "ACCTID":
+			account = value
+		case "STMTTRN":
+			current = map[string]string{}
+		case "/STMTTRN":
+			if current == nil {
+				continue
+			}
+
+			t, ok, err := ofxTransaction(current, account, currency)
+			if err != nil {
+				rowErrors = append(rowErrors, RowError{
+					Row:     fmt.Sprintf("transaction %q", current["FITID"]),
+					Message: err.Error(),
+				})
+			} else if ok {
+				transactions = append(transactions, t)
+			}
+			current = nil
+		default:
+			// The first NAME wins: it is the one of the transaction
+			// itself, not of a nested PAYEE aggregate.
+			if current != nil && !strings.HasPrefix(tag, "/") && current[tag] == "" {
+				current[tag] = value
+			}
+		}
+	}
+
+	return transactions, rowErrors, nil
+}
+
+// ofxTransaction makes a transaction out of the elements of a STMTTRN
+// aggregate. ok is false for credits.
+func ofxTransaction(elements map[string]string, account, currency string) (Transaction, bool, error) {
+	posted := elements["DTPOSTED"]
+	if len(posted) < len("20060102") {
+		return Transaction{}, false, fmt.Errorf("invalid posting date %q", posted)
+	}
+	date, err := time.Parse("20060102", posted[:len("20060102")])
+	if err != nil {
+		return Transaction{}, false, fmt.Errorf("invalid posting date %q", posted)
+	}
+
+	currency, err = parseCurrency(currency)
+	if err != nil {
+		return Transaction{}, false, err
+	}
+
+	amount, negative, err := parseAmount(elements["TRNAMT"], currency)
+	if err != nil {
+		return Transaction{}, false, err
+	}
+	if !negative || amount.Minor == 0 {
+		return Transaction{}, false, nil
+	}
+
+	payee := elements["NAME"]
+	if payee == "" {
+		payee = elements["MEMO"]
+	}
+
+	t := Transaction{
+		Date:   date.Format(time.DateOnly),
+		Payee:  truncatePayee(payee),
+		Amount: amount,
+	}
+	if fitID := elements["FITID"]; fitID != "" {
+		t.ID = "ofx:" + account + ":" + fitID
+	}
+	return t, true, nil
+}
@@ -0,0 +1,146 @@
+package importer
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/recurrence"
+)
+
+// minRecurringCharges is how many charges to one payee it takes to suggest a
+// regular expense.
+const minRecurringCharges = 3
+
+// maxAmountSpread is how much, as a fraction of the smallest charge, charges
+// to one payee may differ to still count as one subscription.
+const maxAmountSpread = 0.2
+
+// recurringIntervals are the schedules charges are matched against, by the
+// range of days between consecutive charges they allow.
+var recurringIntervals = []struct {
+	minDays, maxDays int
+	rule             string
+}{
+	{6, 8, "FREQ=WEEKLY"},
+	{13, 15, "FREQ=WEEKLY;INTERVAL=2"},
+	{27, 32, "FREQ=MONTHLY;SKIP=BACKWARD"},
+	{88, 94, "FREQ=MONTHLY;INTERVAL=3;SKIP=BACKWARD"},
+	{358, 372, "FREQ=YEARLY;SKIP=BACKWARD"},
+}
+
+// Suggestion is a payee charged on a regular schedule, offered to the user as
+// a regular expense.
+type Suggestion struct {
+	Name       string
+	Amount     model.Money
+	Recurrence string
+	Count      int
+	LastDate   string
+	// NextDate is the first date the schedule is due on after LastDate and
+	// not before the day the suggestion is made.
+	NextDate string
+}
+
+// SuggestRecurring finds payees that transactions show to be charged at least
+// minRecurringCharges times, at steady intervals and for similar amounts in
+// one currency. The suggested amount is that of the latest charge.
+func SuggestRecurring(transactions []Transaction, today string) []Suggestion {
+	groups := map[string][]Transaction{}
+	for _, t := range transactions {
+		key := NormalizePayee(t.Payee) + "|" + t.Amount.Currency
+		if !strings.HasPrefix(key, "|") {
+			groups[key] = append(groups[key], t)
+		}
+	}
+
+	var suggestions []Suggestion
+	for _, charges := range groups {
+		if suggestion, ok := suggest(charges, today); ok {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+
+	slices.SortFunc(suggestions, func(a, b Suggestion) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return suggestions
+}
+
+// suggest checks whether charges to one payee follow a schedule.
+func suggest(charges []Transaction, today string) (Suggestion, bool) {
+	slices.SortStableFunc(charges, func(a, b Transaction) int {
+		return strings.Compare(a.Date, b.Date)
+	})
+	charges = slices.CompactFunc(charges, func(a, b Transaction) bool {
+		return a.Date == b.Date
+	})
+	if len(charges) < minRecurringCharges {
+		return Suggestion{}, false
+	}
+
+	smallest, largest := charges[0].Amount.Minor, charges[0].Amount.Minor
+	for _, c := range charges {
+		smallest, largest = min(smallest, c.Amount.Minor), max(largest, c.Amount.Minor)
+	}
+	if float64(largest-smallest) > maxAmountSpread*float64(smallest) {
+		return Suggestion{}, false
+	}
+
+	dates := make([]time.Time, len(charges))
+	for i, c := range charges {
+		var err error
+		if dates[i], err = time.Parse(time.DateOnly, c.Date); err != nil {
+			return Suggestion{}, false
+		}
+	}
+
+	for _, interval := range recurringIntervals {
+		matches := true
+		for i := 1; i < len(dates) && matches; i++ {
+			days := int(dates[i].Sub(dates[i-1]).Hours() / 24)
+			matches = days >= interval.minDays && days <= interval.maxDays
+		}
+		if !matches {
+			continue
+		}
+
+		last := charges[len(charges)-1]
+		next, ok := nextCharge(interval.rule, dates[len(dates)-1], today)
+		if !ok {
+			return Suggestion{}, false
+		}
+
+		return Suggestion{
+			Name:       last.Payee,
+			Amount:     last.Amount,
+			Recurrence: interval.rule,
+			Count:      len(charges),
+			LastDate:   last.Date,
+			NextDate:   next,
+		}, true
+	}
+
+	return Suggestion{}, false
+}
+
+// nextCharge returns the first date after last, and on or after today, that
+// rule starting at last is due on.
+func nextCharge(rule string, last time.Time, today string) (string, bool) {
+	parsed, err := recurrence.Parse(rule)
+	if err != nil {
+		return "", false
+	}
+
+	after := last
+	if day, err := time.Parse(time.DateOnly, today); err == nil && day.AddDate(0, 0, -1).After(last) {
+		after = day.AddDate(0, 0, -1)
+	}
+
+	next, ok := parsed.Next(last, after)
+	if !ok {
+		return "", false
+	}
+	return next.Format(time.DateOnly), true
+}
@@ -8,27 +8,163 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/robfig/cron"
 	"github.com/sergeykhargelia/vct-project/database"
+	"github.com/sergeykhargelia/vct-project/scheduler"
 	"github.com/sergeykhargelia/vct-project/server"
 	"gopkg.in/gomail.v2"
+	"gorm.io/gorm"
 )
 
-func setupDailyRoutine(s *server.Server) {
-	c := cron.New()
-	c.AddFunc("0 0 * * * ", func() {
-		currentDate := time.Now()
-		s.DoRegularPayments(currentDate.Format(time.DateOnly))
+const (
+	RegularPaymentsJob      = "regular_payments"
+	PaymentNotificationsJob = "payment_notifications"
+	NotificationDeliveryJob = "notification_delivery"
+	JobRunsCleanupJob       = "job_runs_cleanup"
+)
+
+// jobRunRetention is how long runs are kept in job_runs. The delivery job
+// alone records a run every minute.
+const jobRunRetention = 14 * 24 * time.Hour
+
+// regularPayments records the payments due on the day of scheduledAt. Budgets
+// are checked right after the payments of the day are recorded.
+func regularPayments(s *server.Server) scheduler.Job {
+	return func(scheduledAt time.Time) error {
+		date := scheduledAt.Format(time.DateOnly)
+		if err := s.DoRegularPayments(date); err != nil {
+			return err
+		}
+		return s.CheckBudgets(date)
+	}
+}
+
+// paymentNotifications queues the reminders due on the day of scheduledAt.
+func paymentNotifications(s *server.Server) scheduler.Job {
+	return func(scheduledAt time.Time) error {
+		return s.NotifyAboutRegularPayments(scheduledAt.Format(time.DateOnly))
+	}
+}
 
-		nextDate := currentDate.AddDate(0, 0, 1)
-		s.NotifyAboutRegularPayments(nextDate.Format(time.DateOnly))
+func setupBackgroundJobs(s *server.Server, sch *scheduler.Scheduler) error {
+	// Reminders run before the payments of the day, while today's
+	// occurrences are still ahead and can be reminded about on the day.
+	err := sch.Register(PaymentNotificationsJob, "0 0 * * *", paymentNotifications(s))
+	if err != nil {
+		return err
+	}
+
+	err = sch.Register(RegularPaymentsJob, "5 0 * * *", regularPayments(s))
+	if err != nil {
+		return err
+	}
+
+	err = sch.Register(NotificationDeliveryJob, "* * * * *", func(scheduledAt time.Time) error {
+		return s.DeliverNotifications(time.Now())
+	})
+	if err != nil {
+		return err
+	}
+
+	return sch.Register(JobRunsCleanupJob, "30 0 * * *", func(scheduledAt time.Time) error {
+		_, err := sch.Prune(scheduledAt.Add(-jobRunRetention))
+		return err
 	})
 }
 
-func initEmailSender() *gomail.Dialer {
+func initNotifiers() []server.Notifier {
 	username := os.Getenv("GMAIL_USERNAME")
 	password := os.Getenv("GMAIL_PASSWORD")
-	return gomail.NewDialer("smtp.gmail.com", 587, username, password)
+
+	notifiers := []server.Notifier{
+		&server.EmailNotifier{Dialer: gomail.NewDialer("smtp.gmail.com", 587, username, password)},
+		server.NewWebhookNotifier(),
+	}
+
+	if endpoint, ok := os.LookupEnv("CHATBOT_API_URL"); ok {
+		notifiers = append(notifiers, server.NewChatBotNotifier(endpoint))
+	}
+
+	return notifiers
+}
+
+func loadExchangeRates(db *gorm.DB, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("Failed to open exchange rates file:", err)
+		return
+	}
+	defer file.Close()
+
+	count, err := database.LoadExchangeRates(db, file)
+	if err != nil {
+		log.Println("Failed to load exchange rates:", err)
+		return
+	}
+
+	log.Printf("Loaded %d exchange rates from %s", count, path)
+}
+
+// newRouter registers every route of the service. The OpenAPI document served
+// at /api/openapi.json has to describe each of them.
+func newRouter(s *server.Server) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/register", s.RegisterHandler).Methods(http.MethodPost)
+	router.HandleFunc("/login", s.LoginHandler).Methods(http.MethodPost)
+	router.HandleFunc("/register", s.RegisterPage).Methods(http.MethodGet)
+	router.HandleFunc("/login", s.LoginPage).Methods(http.MethodGet)
+	router.HandleFunc("/health", s.Health).Methods(http.MethodGet)
+	router.HandleFunc("/calendar/{token:[A-Za-z0-9_-]+}.ics", s.CalendarFeed).Methods(http.MethodGet)
+
+	router.HandleFunc("/", server.AuthMiddleware(s.MainPage)).Methods(http.MethodGet)
+	router.HandleFunc("/regular_expenses", server.AuthMiddleware(s.CreateRegularExpense)).Methods(http.MethodPost)
+	router.HandleFunc("/regular_expenses", server.AuthMiddleware(s.GetUserRegularExpenses)).Methods(http.MethodGet)
+	router.HandleFunc("/regular_expenses/{regular_expense_id}", server.AuthMiddleware(s.UpdateRegularExpense)).Methods(http.MethodPatch)
+	router.HandleFunc("/regular_expenses/{regular_expense_id}", server.AuthMiddleware(s.DeleteRegularExpense)).Methods(http.MethodDelete)
+	router.HandleFunc("/regular_expenses/{regular_expense_id}/edit", server.AuthMiddleware(s.EditRegularExpenseForm)).Methods(http.MethodGet)
+	router.HandleFunc("/regular_expenses/{regular_expense_id}/pause", server.AuthMiddleware(s.PauseRegularExpenseForm)).Methods(http.MethodGet)
+	router.HandleFunc("/regular_expenses/{regular_expense_id}/pause", server.AuthMiddleware(s.PauseRegularExpense)).Methods(http.MethodPost)
+	router.HandleFunc("/regular_expenses/{regular_expense_id}/resume", server.AuthMiddleware(s.ResumeRegularExpense)).Methods(http.MethodPost)
+	router.HandleFunc("/regular_expenses/{regular_expense_id}/restore", server.AuthMiddleware(s.RestoreRegularExpense)).Methods(http.MethodPost)
+	router.HandleFunc("/expenses", server.AuthMiddleware(s.GetUserExpenses)).Methods(http.MethodGet)
+	router.HandleFunc("/expenses", server.AuthMiddleware(s.CreateExpense)).Methods(http.MethodPost)
+	router.HandleFunc("/expenses/summary", server.AuthMiddleware(s.SpendingSummary)).Methods(http.MethodGet)
+	router.HandleFunc("/stats", server.AuthMiddleware(s.Stats)).Methods(http.MethodGet)
+	router.HandleFunc("/forecast", server.AuthMiddleware(s.Forecast)).Methods(http.MethodGet)
+	router.HandleFunc("/expenses/{expense_id}", server.AuthMiddleware(s.UpdateExpense)).Methods(http.MethodPatch)
+	router.HandleFunc("/expenses/{expense_id}", server.AuthMiddleware(s.DeleteExpense)).Methods(http.MethodDelete)
+	router.HandleFunc("/settings", server.AuthMiddleware(s.SettingsPage)).Methods(http.MethodGet)
+	router.HandleFunc("/settings", server.AuthMiddleware(s.UpdateSettings)).Methods(http.MethodPost)
+	router.HandleFunc("/settings/calendar_token", server.AuthMiddleware(s.CreateCalendarToken)).Methods(http.MethodPost)
+	router.HandleFunc("/settings/calendar_token", server.AuthMiddleware(s.DeleteCalendarToken)).Methods(http.MethodDelete)
+	router.HandleFunc("/categories", server.AuthMiddleware(s.CreateCategory)).Methods(http.MethodPost)
+	router.HandleFunc("/categories/{category_id}", server.AuthMiddleware(s.DeleteCategory)).Methods(http.MethodDelete)
+	router.HandleFunc("/export", server.AuthMiddleware(s.Export)).Methods(http.MethodGet)
+	router.HandleFunc("/import", server.AuthMiddleware(s.ImportExpenses)).Methods(http.MethodPost)
+	router.HandleFunc("/budgets", server.AuthMiddleware(s.Budgets)).Methods(http.MethodGet)
+	router.HandleFunc("/budgets", server.AuthMiddleware(s.CreateBudget)).Methods(http.MethodPost)
+	router.HandleFunc("/budgets/{budget_id}", server.AuthMiddleware(s.UpdateBudget)).Methods(http.MethodPatch)
+	router.HandleFunc("/budgets/{budget_id}", server.AuthMiddleware(s.DeleteBudget)).Methods(http.MethodDelete)
+
+	router.HandleFunc("/api/openapi.json", server.OpenAPI).Methods(http.MethodGet)
+
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.NotFoundHandler = http.HandlerFunc(server.APINotFound)
+	api.MethodNotAllowedHandler = http.HandlerFunc(server.APIMethodNotAllowed)
+	api.HandleFunc("/users", s.APIRegister).Methods(http.MethodPost)
+	api.HandleFunc("/tokens", s.APICreateToken).Methods(http.MethodPost)
+	api.HandleFunc("/users/me", server.APIAuthMiddleware(s.APICurrentUser)).Methods(http.MethodGet)
+	api.HandleFunc("/regular_expenses", server.APIAuthMiddleware(s.APIListRegularExpenses)).Methods(http.MethodGet)
+	api.HandleFunc("/regular_expenses", server.APIAuthMiddleware(s.APICreateRegularExpense)).Methods(http.MethodPost)
+	api.HandleFunc("/regular_expenses/{regular_expense_id}", server.APIAuthMiddleware(s.APIGetRegularExpense)).Methods(http.MethodGet)
+	api.HandleFunc("/regular_expenses/{regular_expense_id}", server.APIAuthMiddleware(s.APIUpdateRegularExpense)).Methods(http.MethodPatch)
+	api.HandleFunc("/regular_expenses/{regular_expense_id}", server.APIAuthMiddleware(s.APIDeleteRegularExpense)).Methods(http.MethodDelete)
+	api.HandleFunc("/expenses", server.APIAuthMiddleware(s.APIListExpenses)).Methods(http.MethodGet)
+	api.HandleFunc("/expenses", server.APIAuthMiddleware(s.APICreateExpense)).Methods(http.MethodPost)
+	api.HandleFunc("/expenses/{expense_id}", server.APIAuthMiddleware(s.APIGetExpense)).Methods(http.MethodGet)
+	api.HandleFunc("/expenses/{expense_id}", server.APIAuthMiddleware(s.APIUpdateExpense)).Methods(http.MethodPatch)
+	api.HandleFunc("/expenses/{expense_id}", server.APIAuthMiddleware(s.APIDeleteExpense)).Methods(http.MethodDelete)
+
+	return router
 }
 
 const (
@@ -42,30 +178,46 @@ func main() {
 		log.Fatal(err)
 	}
 
-	s := &server.Server{DB: db, EmailSender: initEmailSender()}
-	setupDailyRoutine(s)
+	if path, ok := os.LookupEnv("EXCHANGE_RATES_CSV"); ok {
+		loadExchangeRates(db, path)
+	}
+
+	baseURL := "http://localhost" + HttpPort
+	if value, ok := os.LookupEnv("BASE_URL"); ok {
+		baseURL = value
+	}
+
+	s := &server.Server{DB: db, Notifiers: initNotifiers(), BaseURL: baseURL}
+
+	sch := scheduler.New(db)
+	if err := setupBackgroundJobs(s, sch); err != nil {
+		log.Fatal(err)
+	}
+
+	// Catch up on payments that fell due while the service was not running.
+	// The catch-up claims today's ticks of the reminders and payments jobs,
+	// so that only one replica runs them and the ticks are not run again
+	// after it. Today's reminders go first, as they do on schedule.
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if _, err := sch.Run(PaymentNotificationsJob, today, paymentNotifications(s)); err != nil {
+		log.Println("Failed to queue today's reminders:", err)
+	}
+	// The payments job is scheduled at 00:05.
+	if _, err := sch.Run(RegularPaymentsJob, today.Add(5*time.Minute), regularPayments(s)); err != nil {
+		log.Println("Failed to catch up on regular payments:", err)
+	}
+	sch.Start()
 
 	go func() {
 		http.Handle("/metrics", promhttp.Handler())
+		http.HandleFunc("/job_runs", sch.HistoryHandler)
 		err := http.ListenAndServe(PrometheusPort, nil)
 		if err != nil {
 			log.Fatal(err)
 		}
 	}()
 
-	router := mux.NewRouter()
-	router.HandleFunc("/register", s.RegisterHandler).Methods(http.MethodPost)
-	router.HandleFunc("/login", s.LoginHandler).Methods(http.MethodPost)
-	router.HandleFunc("/register", s.RegisterPage).Methods(http.MethodGet)
-	router.HandleFunc("/login", s.LoginPage).Methods(http.MethodGet)
-	router.HandleFunc("/health", s.Health).Methods(http.MethodGet)
-
-	router.HandleFunc("/", server.AuthMiddleware(s.MainPage)).Methods(http.MethodGet)
-	router.HandleFunc("/regular_expenses", server.AuthMiddleware(s.CreateRegularExpense)).Methods(http.MethodPost)
-	router.HandleFunc("/regular_expenses", server.AuthMiddleware(s.GetUserRegularExpenses)).Methods(http.MethodGet)
-	router.HandleFunc("/regular_expenses/{regular_expense_id}", server.AuthMiddleware(s.DeleteRegularExpense)).Methods(http.MethodDelete)
-	router.HandleFunc("/expenses", server.AuthMiddleware(s.GetUserExpenses)).Methods(http.MethodGet)
-
 	log.Println("Server started")
-	log.Fatal(http.ListenAndServe(HttpPort, router))
+	log.Fatal(http.ListenAndServe(HttpPort, newRouter(s)))
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sergeykhargelia/vct-project/openapi"
+	"github.com/sergeykhargelia/vct-project/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// routePattern strips the patterns off path variables, turning
+// "/calendar/{token:[A-Za-z0-9_-]+}.ics" into "/calendar/{token}.ics".
+var routePattern = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+func TestOpenAPIDocumentCoversEveryRoute(t *testing.T) {
+	router := newRouter(&server.Server{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var doc openapi.Document
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&doc))
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+
+	registered := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Path prefixes of subrouters are not routes of their own.
+			return nil
+		}
+
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		path := routePattern.ReplaceAllString(template, "{$1}")
+
+		for _, method := range methods {
+			operation := strings.ToLower(method) + " " + path
+			registered[operation] = true
+			assert.NotNil(t, doc.Paths[path][strings.ToLower(method)], "%s is not in the OpenAPI document", operation)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	for path, item := range doc.Paths {
+		for method := range item {
+			assert.True(t, registered[method+" "+path], "%s %s is documented but not registered", method, path)
+		}
+	}
+}
+
+func TestOpenAPIReferencesResolve(t *testing.T) {
+	w := httptest.NewRecorder()
+	server.OpenAPI(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	var doc openapi.Document
+	require.NoError(t, json.NewDecoder(strings.NewReader(w.Body.String())).Decode(&doc))
+
+	refs := regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(w.Body.String(), -1)
+	require.NotEmpty(t, refs)
+	for _, ref := range refs {
+		assert.Contains(t, doc.Components.Schemas, ref[1])
+	}
+
+	user := doc.Components.Schemas["User"]
+	require.NotNil(t, user)
+	assert.NotContains(t, user.Properties, "PasswordHash")
+	assert.NotContains(t, user.Properties, "CalendarToken")
+}
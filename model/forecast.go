@@ -0,0 +1,152 @@
+package model
+
+// Occurrence is a future payment of a regular expense.
+type Occurrence struct {
+	Date   string
+	Amount Money
+	// Last is set on the final occurrence allowed by EndDate,
+	// MaxOccurrences and the recurrence rule.
+	Last bool
+}
+
+// Schedule walks the occurrences of a regular expense from NextDate up to
+// and including a date, the way DoRegularPayments pays them: occurrences
+// within a pause are skipped, a pause without an end holds the schedule, a
+// trial converts at its end, pending amount changes apply from their
+// effective dates and the schedule stops at EndDate and MaxOccurrences.
+// AmountChanges must be loaded in effective date order.
+type Schedule struct {
+	e       RegularExpense
+	until   string
+	changes []AmountChange
+	applied []AmountChange
+	amount  Money
+
+	date      string
+	ok        bool
+	err       error
+	current   Occurrence
+	converted bool
+}
+
+// Schedule returns a Schedule of the occurrences of e due on or before until.
+func (e RegularExpense) Schedule(until string) *Schedule {
+	s := &Schedule{e: e, until: DateOnly(until), changes: e.AmountChanges, amount: e.Amount}
+	if e.NextDate != nil {
+		s.date, s.ok = DateOnly(*e.NextDate), true
+	}
+	return s
+}
+
+// Next advances to the next occurrence, which is then available through
+// Occurrence. It returns false when there are no more occurrences by the
+// until date or an error occurs.
+func (s *Schedule) Next() bool {
+	e := &s.e
+	for s.ok && s.err == nil && s.date <= s.until {
+		if e.MaxOccurrences != nil && e.OccurrenceCount >= *e.MaxOccurrences ||
+			e.EndDate != nil && s.date > DateOnly(*e.EndDate) {
+			s.ok = false
+			return false
+		}
+
+		if e.PausedOn(s.date) {
+			if e.PausedUntil == nil {
+				return false
+			}
+
+			s.advance()
+			continue
+		}
+
+		last, err := e.IsLastOccurrence(s.date)
+		if err != nil {
+			s.err = err
+			return false
+		}
+
+		if e.TrialEndsOn != nil && !e.InTrial(s.date) {
+			s.amount.Minor = e.PostTrialAmount
+			e.TrialEndsOn = nil
+			s.converted = true
+		}
+
+		for len(s.changes) > 0 && DateOnly(s.changes[0].EffectiveDate) <= s.date {
+			s.amount.Minor = s.changes[0].Amount
+			s.applied = append(s.applied, s.changes[0])
+			s.changes = s.changes[1:]
+		}
+
+		s.current = Occurrence{Date: s.date, Amount: s.amount, Last: last}
+		e.OccurrenceCount++
+
+		if last {
+			s.ok = false
+		} else {
+			s.advance()
+		}
+		return true
+	}
+
+	return false
+}
+
+// advance moves to the occurrence after the current one. An occurrence after
+// EndDate ends the schedule right away, so that a series whose remaining
+// occurrences fall within a pause ends with the last one paid.
+func (s *Schedule) advance() {
+	s.date, s.ok, s.err = s.e.OccurrenceAfter(s.date)
+	if s.ok && s.e.EndDate != nil && s.date > DateOnly(*s.e.EndDate) {
+		s.ok = false
+	}
+}
+
+// Occurrence returns the occurrence Next has advanced to.
+func (s *Schedule) Occurrence() Occurrence {
+	return s.current
+}
+
+// Err returns the error that stopped the schedule, if any.
+func (s *Schedule) Err() error {
+	return s.err
+}
+
+// NextDate returns the date of the first occurrence not returned by Next,
+// which is where the schedule stands once the occurrences so far are paid.
+// ok is false when the schedule has ended.
+func (s *Schedule) NextDate() (date string, ok bool) {
+	return s.date, s.ok
+}
+
+// Amount returns the amount in effect after the occurrences so far.
+func (s *Schedule) Amount() Money {
+	return s.amount
+}
+
+// AppliedChanges returns the amount changes that have come into effect by
+// the occurrences so far.
+func (s *Schedule) AppliedChanges() []AmountChange {
+	return s.applied
+}
+
+// Converted reports whether the trial has converted by the occurrences so
+// far.
+func (s *Schedule) Converted() bool {
+	return s.converted
+}
+
+// Forecast returns the occurrences of an active regular expense due from
+// NextDate up to and including until, as walked by Schedule.
+func (e RegularExpense) Forecast(until string) ([]Occurrence, error) {
+	if e.NextDate == nil || e.Status != "" && e.Status != RegularExpenseActive {
+		return nil, nil
+	}
+
+	var occurrences []Occurrence
+	schedule := e.Schedule(until)
+	for schedule.Next() {
+		occurrences = append(occurrences, schedule.Occurrence())
+	}
+
+	return occurrences, schedule.Err()
+}
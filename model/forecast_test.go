@@ -0,0 +1,78 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func forecastDates(t *testing.T, e model.RegularExpense, until string) ([]string, []int64) {
+	occurrences, err := e.Forecast(until)
+	if !assert.NoError(t, err) {
+		return nil, nil
+	}
+
+	var dates []string
+	var amounts []int64
+	for _, occurrence := range occurrences {
+		dates = append(dates, occurrence.Date)
+		amounts = append(amounts, occurrence.Amount.Minor)
+	}
+	return dates, amounts
+}
+
+func TestForecastAppliesTrialAndAmountChanges(t *testing.T) {
+	e := model.RegularExpense{
+		NextDate:        ptr("2026-01-15"),
+		StartDate:       "2026-01-15",
+		Recurrence:      "FREQ=MONTHLY",
+		Amount:          model.Money{Minor: 0, Currency: "USD"},
+		TrialEndsOn:     ptr("2026-02-01"),
+		PostTrialAmount: 999,
+		AmountChanges:   []model.AmountChange{{EffectiveDate: "2026-04-01", Amount: 1299}},
+	}
+
+	dates, amounts := forecastDates(t, e, "2026-04-30")
+	assert.Equal(t, []string{"2026-01-15", "2026-02-15", "2026-03-15", "2026-04-15"}, dates)
+	assert.Equal(t, []int64{0, 999, 999, 1299}, amounts)
+}
+
+func TestForecastSkipsPausesAndStopsAtLimits(t *testing.T) {
+	e := model.RegularExpense{
+		NextDate:    ptr("2026-01-01"),
+		StartDate:   "2026-01-01",
+		Recurrence:  "FREQ=MONTHLY",
+		Amount:      model.Money{Minor: 500, Currency: "RUB"},
+		PausedFrom:  ptr("2026-02-01"),
+		PausedUntil: ptr("2026-04-01"),
+		EndDate:     ptr("2026-05-31"),
+	}
+
+	dates, _ := forecastDates(t, e, "2026-12-31")
+	assert.Equal(t, []string{"2026-01-01", "2026-04-01", "2026-05-01"}, dates)
+
+	occurrences, err := e.Forecast("2026-12-31")
+	if assert.NoError(t, err) && assert.Len(t, occurrences, 3) {
+		assert.True(t, occurrences[2].Last)
+	}
+
+	e.EndDate = nil
+	e.PausedUntil = nil
+	dates, _ = forecastDates(t, e, "2026-12-31")
+	assert.Equal(t, []string{"2026-01-01"}, dates)
+
+	e.PausedFrom = nil
+	e.MaxOccurrences = ptr(uint(4))
+	e.OccurrenceCount = 2
+	dates, _ = forecastDates(t, e, "2026-12-31")
+	assert.Equal(t, []string{"2026-01-01", "2026-02-01"}, dates)
+
+	e.Status = model.RegularExpenseCancelled
+	dates, _ = forecastDates(t, e, "2026-12-31")
+	assert.Empty(t, dates)
+}
@@ -1,30 +1,423 @@
 package model
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/recurrence"
+	"gorm.io/gorm"
+)
+
+const DefaultCurrency = "RUB"
+
+// SupportedCurrencies are the ISO 4217 codes amounts can be recorded in.
+var SupportedCurrencies = []string{"RUB", "USD", "EUR", "GBP", "CNY", "JPY"}
+
+func IsSupportedCurrency(code string) bool {
+	return slices.Contains(SupportedCurrencies, code)
+}
+
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelChat    = "chat"
+)
+
+// User is an account. PasswordHash and CalendarToken are secrets and are left
+// out of JSON, so that they do not leak with preloaded users.
 type User struct {
 	ID           uint64 `gorm:"primaryKey;autoIncrement"`
 	Email        string `gorm:"unique;not null;size:255"`
 	Name         string `gorm:"not null;size:255"`
-	PasswordHash string `gorm:"not null;size:255"`
+	PasswordHash string `gorm:"not null;size:255" json:"-"`
+
+	// NotificationChannels is a comma-separated list of the channels the user
+	// wants reminders on.
+	NotificationChannels string `gorm:"not null;size:100;default:email"`
+	WebhookURL           string `gorm:"size:2048"`
+	ChatID               string `gorm:"size:100"`
+	// DefaultReminderOffsets is a comma-separated list of how many days
+	// before a payment reminders are sent, used by regular expenses that do
+	// not set their own.
+	DefaultReminderOffsets string `gorm:"not null;size:100;default:1"`
+	// BaseCurrency is the currency aggregated views are converted into.
+	BaseCurrency string `gorm:"not null;size:3;default:RUB"`
+	// CalendarToken is the secret part of the URL of the user's calendar
+	// feed of regular payments, nil while the user has no feed.
+	CalendarToken *string `gorm:"size:64;uniqueIndex" json:"-"`
+}
+
+func (u User) Channels() []string {
+	var channels []string
+	for _, channel := range strings.Split(u.NotificationChannels, ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
 }
 
+const (
+	RegularExpenseActive = "active"
+	// RegularExpenseEnded marks a regular expense whose end date or occurrence
+	// limit has been reached.
+	RegularExpenseEnded     = "ended"
+	RegularExpenseCancelled = "cancelled"
+)
+
 type RegularExpense struct {
 	ID          uint64 `gorm:"primaryKey;autoIncrement"`
 	UserID      uint64 `gorm:"index"`
 	Name        string `gorm:"not null;size:50"`
 	Description string
 	NextDate    *string `gorm:"type:date;index"`
-	Frequency   string  `gorm:"type:interval"`
-	Amount      uint    `gorm:"not null"`
+	// StartDate anchors Recurrence: intervals are counted from it, and parts
+	// the rule leaves open, such as the day of the month, are taken from it.
+	StartDate string `gorm:"type:date"`
+	// Recurrence is an iCalendar RRULE, see package recurrence.
+	Recurrence string `gorm:"not null;size:255;default:'FREQ=MONTHLY'"`
+	Amount     Money  `gorm:"embedded"`
+	// ReminderOffsets overrides User.DefaultReminderOffsets when non-empty.
+	ReminderOffsets string `gorm:"not null;size:100;default:''"`
+	// EndDate, when set, is the last date an occurrence may fall on.
+	EndDate *string `gorm:"type:date"`
+	// MaxOccurrences, when set, is how many occurrences are paid in total.
+	MaxOccurrences *uint
+	// OccurrenceCount is how many occurrences have been paid so far.
+	OccurrenceCount uint `gorm:"not null;default:0"`
+	// TrialEndsOn, when set, is the day a trial converts into a paid
+	// subscription. Occurrences from then on cost PostTrialAmount, in minor
+	// units of the regular expense currency.
+	TrialEndsOn     *string `gorm:"type:date;index"`
+	PostTrialAmount int64   `gorm:"not null;default:0"`
+	// TrialReminderDays is how many days before TrialEndsOn the owner is
+	// warned that the trial is about to convert.
+	TrialReminderDays uint `gorm:"not null;default:3"`
+	// PausedFrom, when set, starts a pause during which occurrences are
+	// neither paid nor reminded about. The pause lasts until the day before
+	// PausedUntil, or until the regular expense is resumed when that is nil.
+	PausedFrom  *string `gorm:"type:date"`
+	PausedUntil *string `gorm:"type:date"`
+	// Status is one of RegularExpenseActive, RegularExpenseEnded and
+	// RegularExpenseCancelled. Only active regular expenses are paid.
+	Status      string `gorm:"not null;size:20;default:active;index"`
+	CancelledAt *time.Time
+	CategoryID  *uint64 `gorm:"index"`
+	// Tags is a comma-separated list of lowercase tags, see ParseTags.
+	Tags string `gorm:"not null;size:255;default:''"`
 
-	User User `gorm:"foreignKey:UserID"`
+	User          User           `gorm:"foreignKey:UserID"`
+	Category      *Category      `gorm:"foreignKey:CategoryID;constraint:OnDelete:SET NULL"`
+	AmountChanges []AmountChange `gorm:"foreignKey:RegularExpenseID"`
 }
 
-type Expense struct {
+// MaxReminderOffset is the earliest, in days before a payment, that a
+// reminder can be sent.
+const MaxReminderOffset = 365
+
+// ParseReminderOffsets parses a comma-separated list of reminder offsets in
+// days. The result is sorted in descending order and has no duplicates.
+func ParseReminderOffsets(value string) ([]int, error) {
+	var offsets []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		offset, err := strconv.Atoi(part)
+		if err != nil || offset < 0 || offset > MaxReminderOffset {
+			return nil, fmt.Errorf("invalid reminder offset %q", part)
+		}
+
+		if !slices.Contains(offsets, offset) {
+			offsets = append(offsets, offset)
+		}
+	}
+
+	slices.Sort(offsets)
+	slices.Reverse(offsets)
+	return offsets, nil
+}
+
+// EffectiveReminderOffsets returns the offsets reminders are sent at, falling
+// back to the owner's default. User must be loaded.
+func (e RegularExpense) EffectiveReminderOffsets() []int {
+	offsets, err := ParseReminderOffsets(e.ReminderOffsets)
+	if err != nil || len(offsets) == 0 {
+		offsets, _ = ParseReminderOffsets(e.User.DefaultReminderOffsets)
+	}
+	return offsets
+}
+
+// OccurrenceAfter returns the first date after date, formatted as
+// time.DateOnly, on which the regular expense is due according to its
+// recurrence rule. ok is false when the rule has no further occurrences.
+func (e RegularExpense) OccurrenceAfter(date string) (next string, ok bool, err error) {
+	rule, err := recurrence.Parse(e.Recurrence)
+	if err != nil {
+		return "", false, err
+	}
+
+	start, err := time.Parse(time.DateOnly, DateOnly(e.StartDate))
+	if err != nil {
+		return "", false, err
+	}
+
+	after, err := time.Parse(time.DateOnly, DateOnly(date))
+	if err != nil {
+		return "", false, err
+	}
+
+	occurrence, ok := rule.Next(start, after)
+	return occurrence.Format(time.DateOnly), ok, nil
+}
+
+// IsLastOccurrence reports whether the occurrence on date, which is due after
+// the ones paid so far, is the final one allowed by EndDate, MaxOccurrences
+// and the recurrence rule.
+func (e RegularExpense) IsLastOccurrence(date string) (bool, error) {
+	if e.MaxOccurrences != nil && e.OccurrenceCount+1 >= *e.MaxOccurrences {
+		return true, nil
+	}
+
+	next, ok, err := e.OccurrenceAfter(date)
+	if err != nil {
+		return false, err
+	}
+
+	return !ok || e.EndDate != nil && next > DateOnly(*e.EndDate), nil
+}
+
+// InTrial reports whether the occurrence on date still falls within the trial.
+func (e RegularExpense) InTrial(date string) bool {
+	return e.TrialEndsOn != nil && DateOnly(date) < DateOnly(*e.TrialEndsOn)
+}
+
+// PostTrialPrice is the amount charged once the trial has converted.
+func (e RegularExpense) PostTrialPrice() Money {
+	return Money{Minor: e.PostTrialAmount, Currency: e.Amount.Currency}
+}
+
+// PausedOn reports whether date falls within the pause window.
+func (e RegularExpense) PausedOn(date string) bool {
+	if e.PausedFrom == nil || DateOnly(date) < DateOnly(*e.PausedFrom) {
+		return false
+	}
+	return e.PausedUntil == nil || DateOnly(date) < DateOnly(*e.PausedUntil)
+}
+
+// DateOnly trims the time part that date columns are read back with, e.g.
+// "2026-01-31T00:00:00Z".
+func DateOnly(value string) string {
+	if len(value) > len(time.DateOnly) {
+		return value[:len(time.DateOnly)]
+	}
+	return value
+}
+
+// DefaultCategories are created for every new user, who can then add and
+// remove categories as they like.
+var DefaultCategories = []string{"Streaming", "Utilities", "Groceries", "Transport", "Software", "Health", "Other"}
+
+type Category struct {
+	ID     uint64 `gorm:"primaryKey;autoIncrement"`
+	UserID uint64 `gorm:"not null;uniqueIndex:idx_categories_name"`
+	Name   string `gorm:"not null;size:50;uniqueIndex:idx_categories_name"`
+}
+
+// MaxTagLength is the longest tag ParseTags accepts.
+const MaxTagLength = 30
+
+// ParseTags parses a comma-separated list of tags. Tags are trimmed and
+// lowercased, and the result has no duplicates. It is returned in the form
+// tags are stored in.
+func ParseTags(value string) (string, error) {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+
+		if len([]rune(tag)) > MaxTagLength {
+			return "", fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+		}
+
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	joined := strings.Join(tags, ",")
+	if len(joined) > 255 {
+		return "", errors.New("too many tags")
+	}
+	return joined, nil
+}
+
+// SplitTags returns the tags of a stored tag list.
+func SplitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+// AmountChange is a scheduled price change of a regular expense. It applies to
+// every occurrence on or after EffectiveDate and is folded into
+// RegularExpense.Amount once the first such occurrence has been paid. Amount
+// is in minor units of the regular expense currency.
+type AmountChange struct {
 	ID               uint64 `gorm:"primaryKey;autoIncrement"`
-	UserID           uint64 `gorm:"index"`
-	RegularExpenseID uint64 `gorm:"index"`
-	Date             string `gorm:"type:date;not null"`
+	RegularExpenseID uint64 `gorm:"not null;uniqueIndex:idx_amount_changes_effective"`
+	EffectiveDate    string `gorm:"type:date;not null;uniqueIndex:idx_amount_changes_effective"`
+	Amount           int64  `gorm:"not null"`
+}
+
+// Expense is a payment that actually happened. It is either an occurrence of
+// a RegularExpense or a one-off purchase, in which case RegularExpenseID is nil.
+type Expense struct {
+	ID               uint64  `gorm:"primaryKey;autoIncrement"`
+	UserID           uint64  `gorm:"index;uniqueIndex:idx_expenses_import"`
+	RegularExpenseID *uint64 `gorm:"uniqueIndex:idx_expenses_occurrence"`
+	Date             string  `gorm:"type:date;not null;uniqueIndex:idx_expenses_occurrence"`
+	Name             string  `gorm:"not null;size:50;default:''"`
+	Amount           Money   `gorm:"embedded"`
+	CategoryID       *uint64 `gorm:"index"`
+	Tags             string  `gorm:"not null;size:255;default:''"`
+	// ImportKey identifies an expense imported from a statement, so that
+	// importing the statement again skips it. It is nil for expenses
+	// entered by hand.
+	ImportKey *string `gorm:"size:64;uniqueIndex:idx_expenses_import"`
+	Recurring bool    `gorm:"-"`
+
+	User           User            `gorm:"foreignKey:UserID"`
+	Category       *Category       `gorm:"foreignKey:CategoryID;constraint:OnDelete:SET NULL"`
+	RegularExpense *RegularExpense `gorm:"foreignKey:RegularExpenseID"`
+}
+
+func (e *Expense) AfterFind(tx *gorm.DB) error {
+	e.Recurring = e.RegularExpenseID != nil
+	return nil
+}
+
+// DefaultBudgetThresholds are the percentages of a budget at which its owner
+// is alerted unless the budget sets its own.
+const DefaultBudgetThresholds = "80,100"
+
+// MaxBudgetThreshold is the highest percentage of a budget an alert can be
+// set at.
+const MaxBudgetThreshold = 1000
+
+// ParseBudgetThresholds parses a comma-separated list of percentages. The
+// result is sorted in ascending order and has no duplicates.
+func ParseBudgetThresholds(value string) ([]int, error) {
+	var thresholds []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(part), "%"))
+		if part == "" {
+			continue
+		}
+
+		threshold, err := strconv.Atoi(part)
+		if err != nil || threshold <= 0 || threshold > MaxBudgetThreshold {
+			return nil, fmt.Errorf("invalid budget threshold %q", part)
+		}
+
+		if !slices.Contains(thresholds, threshold) {
+			thresholds = append(thresholds, threshold)
+		}
+	}
+
+	slices.Sort(thresholds)
+	return thresholds, nil
+}
+
+// Budget limits how much a user means to spend in a calendar month, either
+// overall or, when CategoryID is set, in one category. Spending in other
+// currencies is converted into the currency of Amount.
+type Budget struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement"`
+	// A user has one overall budget, with a nil CategoryID, and one budget per
+	// category at most. NULLs are distinct in a unique index, so the overall
+	// budget has an index of its own.
+	UserID     uint64  `gorm:"not null;index;uniqueIndex:idx_budgets_category;uniqueIndex:idx_budgets_overall,where:category_id IS NULL"`
+	CategoryID *uint64 `gorm:"index;uniqueIndex:idx_budgets_category"`
+	Amount     Money   `gorm:"embedded"`
+	// Thresholds are the comma-separated percentages of Amount at which the
+	// owner is alerted, e.g. "80,100".
+	Thresholds string `gorm:"not null;size:100;default:'80,100'"`
+
+	User     User      `gorm:"foreignKey:UserID"`
+	Category *Category `gorm:"foreignKey:CategoryID;constraint:OnDelete:CASCADE"`
+}
+
+// EffectiveThresholds returns the percentages alerts are sent at, falling
+// back to DefaultBudgetThresholds.
+func (b Budget) EffectiveThresholds() []int {
+	thresholds, err := ParseBudgetThresholds(b.Thresholds)
+	if err != nil || len(thresholds) == 0 {
+		thresholds, _ = ParseBudgetThresholds(DefaultBudgetThresholds)
+	}
+	return thresholds
+}
+
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+)
+
+type JobRun struct {
+	ID          uint64    `gorm:"primaryKey;autoIncrement"`
+	Job         string    `gorm:"not null;size:50;uniqueIndex:idx_job_runs_tick"`
+	ScheduledAt time.Time `gorm:"not null;uniqueIndex:idx_job_runs_tick"`
+	StartedAt   time.Time `gorm:"not null"`
+	FinishedAt  *time.Time
+	Status      string `gorm:"not null;size:20"`
+	Error       string
+}
+
+// A notification is sending while a delivery run holds it. NextAttemptAt is
+// then the end of the lease, after which a crashed run's notifications are
+// picked up again.
+const (
+	NotificationPending = "pending"
+	NotificationSending = "sending"
+	NotificationSent    = "sent"
+	NotificationDead    = "dead"
+)
+
+// Notification is an outbox entry: a message to one user over one channel.
+// DedupKey identifies what the message is about, so enqueueing the same
+// reminder twice leaves a single row.
+type Notification struct {
+	ID            uint64    `gorm:"primaryKey;autoIncrement"`
+	UserID        uint64    `gorm:"index;not null"`
+	Channel       string    `gorm:"not null;size:20"`
+	DedupKey      string    `gorm:"not null;size:255;uniqueIndex"`
+	Subject       string    `gorm:"not null"`
+	Body          string    `gorm:"not null"`
+	Status        string    `gorm:"not null;size:20;default:pending;index:idx_notifications_due"`
+	Attempts      uint      `gorm:"not null;default:0"`
+	NextAttemptAt time.Time `gorm:"not null;index:idx_notifications_due"`
+	LastError     string
+	CreatedAt     time.Time
+	SentAt        *time.Time
+
+	User User `gorm:"foreignKey:UserID"`
+}
 
-	User           User           `gorm:"foreignKey:UserID"`
-	RegularExpense RegularExpense `gorm:"foreignKey:RegularExpenseID"`
+// ExchangeRate is the price of one unit of FromCurrency in ToCurrency, in
+// effect from Date until the next rate of the same pair.
+type ExchangeRate struct {
+	Date         string  `gorm:"type:date;primaryKey"`
+	FromCurrency string  `gorm:"size:3;primaryKey"`
+	ToCurrency   string  `gorm:"size:3;primaryKey"`
+	Rate         float64 `gorm:"type:numeric(20,10);not null"`
 }
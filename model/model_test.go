@@ -0,0 +1,54 @@
+package model_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTags(t *testing.T) {
+	table := []struct {
+		value string
+		tags  string
+	}{
+		{"", ""},
+		{"work", "work"},
+		{" Work , family,,work ", "work,family"},
+		{"Kids Clubs, SPORT", "kids clubs,sport"},
+	}
+
+	for _, params := range table {
+		tags, err := model.ParseTags(params.value)
+		if assert.NoError(t, err, params.value) {
+			assert.Equal(t, params.tags, tags)
+		}
+	}
+
+	_, err := model.ParseTags(strings.Repeat("a", model.MaxTagLength+1))
+	assert.Error(t, err)
+}
+
+func TestParseBudgetThresholds(t *testing.T) {
+	table := []struct {
+		value      string
+		thresholds []int
+	}{
+		{"", nil},
+		{"80,100", []int{80, 100}},
+		{" 100%, 50 ,80,100 ", []int{50, 80, 100}},
+	}
+
+	for _, params := range table {
+		thresholds, err := model.ParseBudgetThresholds(params.value)
+		if assert.NoError(t, err, params.value) {
+			assert.Equal(t, params.thresholds, thresholds)
+		}
+	}
+
+	for _, value := range []string{"0", "-10", "eighty", "1001"} {
+		_, err := model.ParseBudgetThresholds(value)
+		assert.Error(t, err, value)
+	}
+}
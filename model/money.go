@@ -0,0 +1,143 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// currencyExponents is the number of minor-unit digits of each supported
+// currency.
+var currencyExponents = map[string]int{
+	"RUB": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"CNY": 2,
+	"JPY": 0,
+}
+
+var currencySymbols = map[string]string{
+	"RUB": "₽",
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"CNY": "¥",
+	"JPY": "¥",
+}
+
+// CurrencyExponent returns the number of minor-unit digits of code.
+func CurrencyExponent(code string) int {
+	if exponent, ok := currencyExponents[code]; ok {
+		return exponent
+	}
+	return 2
+}
+
+func CurrencySymbol(code string) string {
+	if symbol, ok := currencySymbols[code]; ok {
+		return symbol
+	}
+	return code
+}
+
+// Money is an amount in minor units of its currency, e.g. kopecks or cents.
+// Embedded into a model it is stored in the amount and currency columns.
+type Money struct {
+	Minor    int64  `gorm:"column:amount;not null;default:0"`
+	Currency string `gorm:"column:currency;not null;size:3;default:RUB"`
+}
+
+// ParseMoney parses a non-negative decimal amount such as "299.99" or
+// "299,99" in the given currency. More fractional digits than the currency
+// has minor units are rejected rather than rounded.
+func ParseMoney(value, currency string) (Money, error) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), ",", ".")
+	if value == "" {
+		return Money{}, errors.New("amount is empty")
+	}
+
+	whole, fraction, hasFraction := strings.Cut(value, ".")
+	exponent := CurrencyExponent(currency)
+	if hasFraction && (len(fraction) == 0 || len(fraction) > exponent) {
+		return Money{}, fmt.Errorf("amount %q has too many decimal places for %s", value, currency)
+	}
+
+	digits := whole + fraction + strings.Repeat("0", exponent-len(fraction))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Money{}, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+
+	minor, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// Decimal formats the amount without the currency, e.g. "299.99".
+func (m Money) Decimal() string {
+	exponent := CurrencyExponent(m.Currency)
+	sign := ""
+	minor := m.Minor
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+
+	digits := fmt.Sprintf("%0*d", exponent+1, minor)
+	if exponent == 0 {
+		return sign + digits
+	}
+
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+// String formats the amount with its currency code, e.g. "299.99 USD".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Convert converts the amount into currency to at rate, the price of one
+// whole unit of m.Currency in whole units of to, rounding to the nearest
+// minor unit.
+func (m Money) Convert(rate float64, to string) Money {
+	scale := math.Pow10(CurrencyExponent(to) - CurrencyExponent(m.Currency))
+	return Money{Minor: int64(math.Round(float64(m.Minor) * rate * scale)), Currency: to}
+}
+
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes the amount as a decimal string, so that clients do not
+// lose precision to floating point.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Decimal(), Currency: m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var value moneyJSON
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	if !IsSupportedCurrency(value.Currency) {
+		return fmt.Errorf("unsupported currency %q", value.Currency)
+	}
+
+	parsed, err := ParseMoney(value.Amount, value.Currency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
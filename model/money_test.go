@@ -0,0 +1,74 @@
+package model_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	table := []struct {
+		value    string
+		currency string
+		minor    int64
+	}{
+		{"299.99", "USD", 29999},
+		{"299,99", "RUB", 29999},
+		{"299.9", "EUR", 29990},
+		{"700", "RUB", 70000},
+		{"0.05", "RUB", 5},
+		{"1500", "JPY", 1500},
+	}
+
+	for _, params := range table {
+		money, err := model.ParseMoney(params.value, params.currency)
+		if assert.NoError(t, err, params.value) {
+			assert.Equal(t, model.Money{Minor: params.minor, Currency: params.currency}, money)
+		}
+	}
+}
+
+func TestParseMoneyRejectsInvalidAmounts(t *testing.T) {
+	table := []struct {
+		value    string
+		currency string
+	}{
+		{"", "RUB"},
+		{"abc", "RUB"},
+		{"-5", "RUB"},
+		{"1.999", "USD"},
+		{"10.5", "JPY"},
+		{"10.", "RUB"},
+		{"1.2.3", "RUB"},
+	}
+
+	for _, params := range table {
+		_, err := model.ParseMoney(params.value, params.currency)
+		assert.Error(t, err, params.value)
+	}
+}
+
+func TestMoneyFormatting(t *testing.T) {
+	assert.Equal(t, "299.99", model.Money{Minor: 29999, Currency: "USD"}.Decimal())
+	assert.Equal(t, "0.05", model.Money{Minor: 5, Currency: "RUB"}.Decimal())
+	assert.Equal(t, "1500", model.Money{Minor: 1500, Currency: "JPY"}.Decimal())
+	assert.Equal(t, "-1.50 EUR", model.Money{Minor: -150, Currency: "EUR"}.String())
+}
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	data, err := json.Marshal(model.Money{Minor: 29999, Currency: "USD"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount": "299.99", "currency": "USD"}`, string(data))
+
+	var money model.Money
+	assert.NoError(t, json.Unmarshal(data, &money))
+	assert.Equal(t, model.Money{Minor: 29999, Currency: "USD"}, money)
+}
+
+func TestMoneyConvert(t *testing.T) {
+	assert.Equal(t, model.Money{Minor: 785000, Currency: "RUB"}, model.Money{Minor: 10000, Currency: "USD"}.Convert(78.5, "RUB"))
+	assert.Equal(t, model.Money{Minor: 1500, Currency: "JPY"}, model.Money{Minor: 1000, Currency: "USD"}.Convert(150, "JPY"))
+	assert.Equal(t, model.Money{Minor: 667, Currency: "USD"}, model.Money{Minor: 1000, Currency: "JPY"}.Convert(1.0/150, "USD"))
+}
@@ -0,0 +1,78 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type audit struct {
+	CreatedAt time.Time
+}
+
+type node struct {
+	audit
+	ID       uint64  `json:"id"`
+	Label    *string `json:"label"`
+	Weight   float64 `json:"weight,omitempty"`
+	Born     *string `json:"born" format:"date"`
+	Secret   string  `json:"-"`
+	Count    int64   `json:"count,string"`
+	Children []node  `json:"children"`
+	Parent   *node   `json:"parent"`
+	internal bool
+}
+
+type page[T any] struct {
+	Items []T `json:"items"`
+}
+
+type price struct{ cents int64 }
+
+func (p price) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.cents)
+}
+
+func TestSchemaOfStruct(t *testing.T) {
+	g := openapi.NewGenerator()
+
+	assert.Equal(t, openapi.Ref("Node"), g.SchemaOf(node{}))
+
+	schema := g.Schemas["Node"]
+	require.NotNil(t, schema)
+	assert.Equal(t, "object", schema.Type)
+	assert.ElementsMatch(t, []string{"CreatedAt", "id", "label", "born", "count", "children", "parent"}, schema.Required)
+	assert.Equal(t, openapi.String("date-time"), schema.Properties["CreatedAt"])
+	assert.Equal(t, "integer", schema.Properties["id"].Type)
+	assert.Equal(t, &openapi.Schema{Type: "string", Nullable: true}, schema.Properties["label"])
+	assert.Equal(t, &openapi.Schema{Type: "number", Format: "double"}, schema.Properties["weight"])
+	assert.Equal(t, &openapi.Schema{Type: "string", Format: "date", Nullable: true}, schema.Properties["born"])
+	assert.Equal(t, openapi.String(""), schema.Properties["count"])
+	assert.Equal(t, openapi.ArrayOf(openapi.Ref("Node")), schema.Properties["children"])
+	assert.Equal(t, openapi.Ref("Node"), schema.Properties["parent"])
+	assert.NotContains(t, schema.Properties, "Secret")
+	assert.NotContains(t, schema.Properties, "internal")
+	assert.NotContains(t, g.Schemas, "Audit")
+}
+
+func TestSchemaOfGenericType(t *testing.T) {
+	g := openapi.NewGenerator()
+
+	assert.Equal(t, openapi.Ref("PageNode"), g.SchemaOf(page[node]{}))
+	assert.Equal(t, openapi.ArrayOf(openapi.Ref("Node")), g.Schemas["PageNode"].Properties["items"])
+}
+
+func TestSchemaOfCustomMarshaler(t *testing.T) {
+	g := openapi.NewGenerator()
+	assert.Panics(t, func() { g.SchemaOf(price{}) })
+
+	g = openapi.NewGenerator()
+	g.Define(price{}, &openapi.Schema{Type: "integer"})
+
+	assert.Equal(t, openapi.Ref("Price"), g.SchemaOf([]price{}).Items)
+	assert.Equal(t, &openapi.Schema{Type: "integer"}, g.Schemas["Price"])
+}
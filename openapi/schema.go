@@ -0,0 +1,220 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// Generator derives schemas from Go types. Named struct types become
+// component schemas, referred to by name wherever they are used, so that
+// recursive types are described once.
+type Generator struct {
+	// Schemas are the component schemas generated so far, to be put into
+	// Document.Components.
+	Schemas map[string]*Schema
+
+	names  map[reflect.Type]string
+	custom map[reflect.Type]*Schema
+}
+
+func NewGenerator() *Generator {
+	return &Generator{
+		Schemas: map[string]*Schema{},
+		names:   map[reflect.Type]string{},
+		custom:  map[reflect.Type]*Schema{},
+	}
+}
+
+// Define sets the schema of the type of v, which is needed for types with
+// their own MarshalJSON. The schema becomes a component named after the type.
+func (g *Generator) Define(v any, schema *Schema) {
+	g.custom[reflect.TypeOf(v)] = schema
+}
+
+// SchemaOf returns the schema of the JSON encoding of v.
+func (g *Generator) SchemaOf(v any) *Schema {
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *Generator) schema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		schema := g.schema(t.Elem())
+		if schema.Ref != "" {
+			// Siblings of $ref are ignored in OpenAPI 3.0, so nullable
+			// references are not marked.
+			return schema
+		}
+		nullable := *schema
+		nullable.Nullable = true
+		return &nullable
+	}
+
+	if custom, ok := g.custom[t]; ok {
+		return g.component(t, func() *Schema { return custom })
+	}
+
+	switch {
+	case t == timeType:
+		return String("date-time")
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		panic(fmt.Sprintf("openapi: %s has its own MarshalJSON, its schema has to be defined", t))
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return String("")
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: "integer", Format: "int64", Minimum: &zero}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return String("")
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return String("byte")
+		}
+		return ArrayOf(g.schema(t.Elem()))
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return g.component(t, func() *Schema { return g.object(t) })
+	case reflect.Interface:
+		return &Schema{}
+	default:
+		panic(fmt.Sprintf("openapi: %s cannot be encoded as JSON", t))
+	}
+}
+
+// component returns a reference to the component schema of t, building it
+// with build the first time t is seen.
+func (g *Generator) component(t reflect.Type, build func() *Schema) *Schema {
+	if name, ok := g.names[t]; ok {
+		return Ref(name)
+	}
+
+	name := g.componentName(t)
+	g.names[t] = name
+	// Reserved before building, so that recursive references resolve.
+	g.Schemas[name] = &Schema{}
+	*g.Schemas[name] = *build()
+	return Ref(name)
+}
+
+// componentName names the component schema of t after the type, with the
+// package name in front when another package already has a type of that
+// name. Type arguments of generic types are appended, so that
+// page[expense] becomes PageExpense.
+func (g *Generator) componentName(t reflect.Type) string {
+	name, args, _ := strings.Cut(t.Name(), "[")
+	name = exported(name)
+	for _, arg := range strings.Split(strings.TrimSuffix(args, "]"), ",") {
+		if arg == "" {
+			continue
+		}
+		arg = arg[strings.LastIndex(arg, ".")+1:]
+		name += exported(arg)
+	}
+
+	if _, taken := g.Schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = exported(pkg[strings.LastIndex(pkg, "/")+1:]) + name
+	}
+	return name
+}
+
+func exported(name string) string {
+	runes := []rune(name)
+	if len(runes) > 0 {
+		runes[0] = unicode.ToUpper(runes[0])
+	}
+	return string(runes)
+}
+
+// withFormat returns a copy of schema with format set, on the items for
+// arrays, so that a field tagged `format:"date"` can be a list of dates.
+func withFormat(schema *Schema, format string) *Schema {
+	formatted := *schema
+	if formatted.Items != nil {
+		formatted.Items = withFormat(formatted.Items, format)
+	} else if formatted.Ref == "" {
+		formatted.Format = format
+	}
+	return &formatted
+}
+
+// object describes the fields of a struct as encoding/json encodes them:
+// under the name in the json tag or the field name, skipping unexported
+// fields and fields tagged "-", and inlining embedded structs. Fields without
+// omitempty are always present and therefore required. A format tag sets the
+// format of a field, e.g. `format:"date"` for dates kept in strings.
+func (g *Generator) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, schema)
+	return schema
+}
+
+func (g *Generator) fields(t reflect.Type, schema *Schema) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.fields(embedded, schema)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schema(field.Type)
+		if strings.Contains(options, "string") && property.Ref == "" {
+			property = &Schema{Type: "string", Nullable: property.Nullable}
+		}
+		if format := field.Tag.Get("format"); format != "" {
+			property = withFormat(property, format)
+		}
+		schema.Properties[name] = property
+
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
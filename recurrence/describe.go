@@ -0,0 +1,101 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var frequencyUnits = map[Frequency]string{
+	Daily:   "day",
+	Weekly:  "week",
+	Monthly: "month",
+	Yearly:  "year",
+}
+
+// Describe returns a short English description of the rule, such as
+// "every 2 weeks on Mon" or "monthly on the last of Mon, Tue, Wed, Thu, Fri".
+func (r Rule) Describe() string {
+	var b strings.Builder
+
+	if r.Interval == 1 {
+		b.WriteString(strings.ToLower(frequencyNames[r.Freq]))
+	} else {
+		fmt.Fprintf(&b, "every %d %ss", r.Interval, frequencyUnits[r.Freq])
+	}
+
+	// Days counted from the end of the month read better after the others.
+	var days, fromEnd []string
+	for _, day := range r.ByMonthDay {
+		if day < 0 {
+			fromEnd = append([]string{describeMonthDay(day)}, fromEnd...)
+		} else {
+			days = append(days, describeMonthDay(day))
+		}
+	}
+	days = append(days, fromEnd...)
+	for _, day := range r.ByDay {
+		days = append(days, describeWeekday(day))
+	}
+
+	if len(days) > 0 {
+		b.WriteString(" on ")
+		if len(r.BySetPos) > 0 {
+			positions := make([]string, len(r.BySetPos))
+			for i, pos := range r.BySetPos {
+				positions[i] = ordinal(pos)
+			}
+			b.WriteString("the " + strings.Join(positions, " and ") + " of ")
+		}
+		b.WriteString(strings.Join(days, ", "))
+	}
+
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, month := range r.ByMonth {
+			months[i] = month.String()[:3]
+		}
+		b.WriteString(" in " + strings.Join(months, ", "))
+	}
+
+	return b.String()
+}
+
+func describeMonthDay(day int) string {
+	if day < 0 {
+		return "the " + ordinal(day) + " day"
+	}
+	return "the " + ordinal(day)
+}
+
+func describeWeekday(day WeekdayNum) string {
+	name := day.Weekday.String()[:3]
+	if day.Ordinal == 0 {
+		return name
+	}
+	return "the " + ordinal(day.Ordinal) + " " + name
+}
+
+// ordinal formats positions such as 1, 22 and -2 as "1st", "22nd" and
+// "2nd to last".
+func ordinal(n int) string {
+	switch {
+	case n == -1:
+		return "last"
+	case n < 0:
+		return ordinal(-n) + " to last"
+	}
+
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
@@ -0,0 +1,257 @@
+package recurrence
+
+import (
+	"slices"
+	"time"
+)
+
+// maxPeriods bounds how many periods Next looks through before deciding that
+// a rule has no more occurrences. It is enough to reach February 29 from any
+// date with a DAILY rule.
+const maxPeriods = 4000
+
+// First returns the first occurrence on or after start of the series that
+// starts at start.
+func (r Rule) First(start time.Time) (time.Time, bool) {
+	start = dateOf(start)
+	return r.Next(start, start.AddDate(0, 0, -1))
+}
+
+// Next returns the first occurrence strictly after after of the series that
+// starts at start. Parts the rule leaves open are taken from start: the
+// weekday of a WEEKLY rule, the day of the month of a MONTHLY rule and the
+// month and day of a YEARLY rule. Unlike in RFC 5545, start itself is an
+// occurrence only if it matches the rule. Times of day are ignored and the
+// result is at midnight UTC. ok is false when the rule has no further
+// occurrences.
+func (r Rule) Next(start, after time.Time) (time.Time, bool) {
+	start, after = dateOf(start), dateOf(after)
+	if after.Before(start) {
+		after = start.AddDate(0, 0, -1)
+	}
+
+	first := r.periodOf(start)
+	// Occurrences moved by SKIP may land in the neighbouring period, so the
+	// search starts one period before the one holding after.
+	index := (r.periodOf(after) - first) / r.Interval * r.Interval
+	index = max(0, index-r.Interval)
+
+	var best time.Time
+	for i := 0; i < maxPeriods; i++ {
+		// The period after the first match is still looked at in case SKIP
+		// moved one of its occurrences back before the match.
+		matched := !best.IsZero()
+
+		for _, occurrence := range r.occurrences(first+index, start) {
+			if occurrence.After(after) && (best.IsZero() || occurrence.Before(best)) {
+				best = occurrence
+			}
+		}
+
+		if matched {
+			return best, true
+		}
+
+		index += r.Interval
+	}
+
+	return best, !best.IsZero()
+}
+
+// periodOf numbers the periods of the rule frequency: days, weeks starting on
+// Monday, months or years.
+func (r Rule) periodOf(date time.Time) int {
+	switch r.Freq {
+	case Daily:
+		return dayNumber(date)
+	case Weekly:
+		// January 5, 1970 is the first Monday after the Unix epoch.
+		return floorDiv(dayNumber(date)-4, 7)
+	case Monthly:
+		return date.Year()*12 + int(date.Month()) - 1
+	default:
+		return date.Year()
+	}
+}
+
+// occurrences returns the sorted occurrences in the given period, leaving out
+// those before start.
+func (r Rule) occurrences(period int, start time.Time) []time.Time {
+	var candidates []time.Time
+
+	switch r.Freq {
+	case Daily:
+		day := dateOfNumber(period)
+		if r.matchesMonth(day) && r.matchesMonthDay(day) && r.matchesWeekday(day) {
+			candidates = append(candidates, day)
+		}
+	case Weekly:
+		monday := dateOfNumber(period*7 + 4)
+		for offset := 0; offset < 7; offset++ {
+			day := monday.AddDate(0, 0, offset)
+			if len(r.ByDay) == 0 && day.Weekday() != start.Weekday() {
+				continue
+			}
+			if r.matchesWeekday(day) && r.matchesMonth(day) {
+				candidates = append(candidates, day)
+			}
+		}
+	case Monthly:
+		year, month := period/12, time.Month(period%12+1)
+		if len(r.ByMonth) == 0 || slices.Contains(r.ByMonth, month) {
+			candidates = r.inMonth(year, month, start)
+		}
+	case Yearly:
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{start.Month()}
+		}
+		for _, month := range months {
+			candidates = append(candidates, r.inMonth(period, month, start)...)
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b time.Time) int { return a.Compare(b) })
+	candidates = slices.CompactFunc(candidates, func(a, b time.Time) bool { return a.Equal(b) })
+	candidates = r.selectSetPos(candidates)
+
+	return slices.DeleteFunc(candidates, func(day time.Time) bool { return day.Before(start) })
+}
+
+// inMonth expands the rule within one month of a MONTHLY or YEARLY rule.
+func (r Rule) inMonth(year int, month time.Month, start time.Time) []time.Time {
+	var days []time.Time
+
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, monthDay := range r.ByMonthDay {
+			if day, ok := r.resolve(year, month, monthDay); ok && r.matchesWeekday(day) {
+				days = append(days, day)
+			}
+		}
+	case len(r.ByDay) > 0:
+		for _, weekday := range r.ByDay {
+			days = append(days, weekdaysInMonth(year, month, weekday)...)
+		}
+	default:
+		if day, ok := r.resolve(year, month, start.Day()); ok {
+			days = append(days, day)
+		}
+	}
+
+	return days
+}
+
+// resolve returns the given day of a month, counting from the end when
+// monthDay is negative. Days the month does not have are handled according
+// to r.Skip.
+func (r Rule) resolve(year int, month time.Month, monthDay int) (time.Time, bool) {
+	length := daysIn(year, month)
+	day := monthDay
+	if monthDay < 0 {
+		day = length + monthDay + 1
+	}
+
+	switch {
+	case day >= 1 && day <= length:
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), true
+	case r.Skip == Backward && day > length:
+		return time.Date(year, month, length, 0, 0, 0, 0, time.UTC), true
+	case r.Skip == Backward:
+		// The last day of the previous month.
+		return time.Date(year, month, 0, 0, 0, 0, 0, time.UTC), true
+	case r.Skip == Forward && day > length:
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC), true
+	case r.Skip == Forward:
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func weekdaysInMonth(year int, month time.Month, weekday WeekdayNum) []time.Time {
+	var days []time.Time
+	for day := 1; day <= daysIn(year, month); day++ {
+		date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		if date.Weekday() == weekday.Weekday {
+			days = append(days, date)
+		}
+	}
+
+	if weekday.Ordinal == 0 {
+		return days
+	}
+
+	index := weekday.Ordinal - 1
+	if weekday.Ordinal < 0 {
+		index = len(days) + weekday.Ordinal
+	}
+	if index < 0 || index >= len(days) {
+		return nil
+	}
+	return days[index : index+1]
+}
+
+func (r Rule) selectSetPos(candidates []time.Time) []time.Time {
+	if len(r.BySetPos) == 0 {
+		return candidates
+	}
+
+	var selected []time.Time
+	for _, pos := range r.BySetPos {
+		index := pos - 1
+		if pos < 0 {
+			index = len(candidates) + pos
+		}
+		if index >= 0 && index < len(candidates) {
+			selected = append(selected, candidates[index])
+		}
+	}
+
+	slices.SortFunc(selected, func(a, b time.Time) int { return a.Compare(b) })
+	return slices.CompactFunc(selected, func(a, b time.Time) bool { return a.Equal(b) })
+}
+
+func (r Rule) matchesMonth(day time.Time) bool {
+	return len(r.ByMonth) == 0 || slices.Contains(r.ByMonth, day.Month())
+}
+
+func (r Rule) matchesMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	fromEnd := day.Day() - daysIn(day.Year(), day.Month()) - 1
+	return slices.Contains(r.ByMonthDay, day.Day()) || slices.Contains(r.ByMonthDay, fromEnd)
+}
+
+func (r Rule) matchesWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(r.ByDay, func(weekday WeekdayNum) bool { return weekday.Weekday == day.Weekday() })
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// dayNumber numbers days from the Unix epoch.
+func dayNumber(date time.Time) int {
+	return int(floorDiv(date.Unix(), 24*60*60))
+}
+
+func dateOfNumber(day int) time.Time {
+	return time.Unix(int64(day)*24*60*60, 0).UTC()
+}
+
+func floorDiv[T ~int | ~int64](a, b T) T {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
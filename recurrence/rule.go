@@ -0,0 +1,335 @@
+// Package recurrence parses and evaluates recurrence rules written in a
+// subset of the iCalendar RRULE syntax (RFC 5545, section 3.3.10), extended
+// with the SKIP rule part of RFC 7529 to make the handling of dates that do
+// not exist in a month explicit.
+//
+// Supported rule parts are FREQ (DAILY, WEEKLY, MONTHLY or YEARLY), INTERVAL,
+// BYMONTH, BYMONTHDAY, BYDAY, BYSETPOS and SKIP. RSCALE is accepted only as
+// GREGORIAN. Rules work on whole dates: there are no times of day, and weeks
+// always start on Monday.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency int
+
+const (
+	Daily Frequency = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+var frequencyNames = map[Frequency]string{
+	Daily:   "DAILY",
+	Weekly:  "WEEKLY",
+	Monthly: "MONTHLY",
+	Yearly:  "YEARLY",
+}
+
+// Skip says what happens to an occurrence that falls on a day the month does
+// not have, such as the 31st in April or the 29th of February in 2027.
+type Skip int
+
+const (
+	// Omit drops the occurrence. This is the default, as in RFC 7529.
+	Omit Skip = iota
+	// Backward moves the occurrence to the closest earlier existing day,
+	// e.g. from February 30 to February 28.
+	Backward
+	// Forward moves the occurrence to the closest later existing day,
+	// e.g. from February 30 to March 1.
+	Forward
+)
+
+var skipNames = map[Skip]string{
+	Omit:     "OMIT",
+	Backward: "BACKWARD",
+	Forward:  "FORWARD",
+}
+
+var weekdayNames = map[time.Weekday]string{
+	time.Monday:    "MO",
+	time.Tuesday:   "TU",
+	time.Wednesday: "WE",
+	time.Thursday:  "TH",
+	time.Friday:    "FR",
+	time.Saturday:  "SA",
+	time.Sunday:    "SU",
+}
+
+// WeekdayNum is a BYDAY entry. A non-zero Ordinal selects the n-th such
+// weekday of the month, counting from the end when negative.
+type WeekdayNum struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+func (w WeekdayNum) String() string {
+	if w.Ordinal == 0 {
+		return weekdayNames[w.Weekday]
+	}
+	return strconv.Itoa(w.Ordinal) + weekdayNames[w.Weekday]
+}
+
+// Rule is a parsed recurrence rule. The zero value is not valid, use Parse.
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	ByMonth    []time.Month
+	ByMonthDay []int
+	ByDay      []WeekdayNum
+	BySetPos   []int
+	Skip       Skip
+}
+
+// MaxInterval is the largest INTERVAL a rule may have.
+const MaxInterval = 1000
+
+// Parse parses a rule such as "FREQ=MONTHLY;BYMONTHDAY=15,-1;SKIP=BACKWARD".
+// An "RRULE:" prefix is allowed, and names and values are case-insensitive.
+func Parse(value string) (Rule, error) {
+	value = strings.TrimSpace(value)
+	if len(value) >= len("RRULE:") && strings.EqualFold(value[:len("RRULE:")], "RRULE:") {
+		value = value[len("RRULE:"):]
+	}
+
+	rule := Rule{Freq: -1, Interval: 1}
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+
+		name, val, found := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		val = strings.ToUpper(strings.TrimSpace(val))
+		if !found || val == "" {
+			return Rule{}, fmt.Errorf("invalid rule part %q", part)
+		}
+		if seen[name] {
+			return Rule{}, fmt.Errorf("%s is given more than once", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			err = rule.parseFreq(val)
+		case "INTERVAL":
+			rule.Interval, err = parseInt(val, 1, MaxInterval)
+		case "BYMONTH":
+			err = parseList(val, func(item string) error {
+				month, err := parseInt(item, 1, 12)
+				rule.ByMonth = append(rule.ByMonth, time.Month(month))
+				return err
+			})
+		case "BYMONTHDAY":
+			err = parseList(val, func(item string) error {
+				day, err := parseSignedInt(item, 31)
+				rule.ByMonthDay = append(rule.ByMonthDay, day)
+				return err
+			})
+		case "BYDAY":
+			err = parseList(val, func(item string) error {
+				day, err := parseWeekdayNum(item)
+				rule.ByDay = append(rule.ByDay, day)
+				return err
+			})
+		case "BYSETPOS":
+			err = parseList(val, func(item string) error {
+				pos, err := parseSignedInt(item, 366)
+				rule.BySetPos = append(rule.BySetPos, pos)
+				return err
+			})
+		case "SKIP":
+			err = rule.parseSkip(val)
+		case "RSCALE":
+			if val != "GREGORIAN" {
+				err = errors.New("only the GREGORIAN calendar is supported")
+			}
+		case "COUNT", "UNTIL", "WKST", "BYWEEKNO", "BYYEARDAY", "BYHOUR", "BYMINUTE", "BYSECOND":
+			err = errors.New("not supported")
+		default:
+			err = errors.New("unknown rule part")
+		}
+
+		if err != nil {
+			return Rule{}, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if err := rule.validate(); err != nil {
+		return Rule{}, err
+	}
+
+	rule.normalize()
+	return rule, nil
+}
+
+func (r *Rule) parseFreq(value string) error {
+	for freq, name := range frequencyNames {
+		if name == value {
+			r.Freq = freq
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported frequency %q", value)
+}
+
+func (r *Rule) parseSkip(value string) error {
+	for skip, name := range skipNames {
+		if name == value {
+			r.Skip = skip
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid value %q", value)
+}
+
+func parseList(value string, parseItem func(string) error) error {
+	for _, item := range strings.Split(value, ",") {
+		if err := parseItem(strings.TrimSpace(item)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseInt(value string, min, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%q should be a number from %d to %d", value, min, max)
+	}
+	return n, nil
+}
+
+// parseSignedInt parses a non-zero number from -max to max.
+func parseSignedInt(value string, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n == 0 || n < -max || n > max {
+		return 0, fmt.Errorf("%q should be a non-zero number from %d to %d", value, -max, max)
+	}
+	return n, nil
+}
+
+func parseWeekdayNum(value string) (WeekdayNum, error) {
+	if len(value) < 2 {
+		return WeekdayNum{}, fmt.Errorf("invalid weekday %q", value)
+	}
+
+	var day WeekdayNum
+	name := value[len(value)-2:]
+	found := false
+	for weekday, weekdayName := range weekdayNames {
+		if weekdayName == name {
+			day.Weekday = weekday
+			found = true
+		}
+	}
+	if !found {
+		return WeekdayNum{}, fmt.Errorf("invalid weekday %q", value)
+	}
+
+	if ordinal := value[:len(value)-2]; ordinal != "" {
+		n, err := parseSignedInt(strings.TrimPrefix(ordinal, "+"), 5)
+		if err != nil {
+			return WeekdayNum{}, fmt.Errorf("invalid weekday %q", value)
+		}
+		day.Ordinal = n
+	}
+
+	return day, nil
+}
+
+func (r Rule) validate() error {
+	if r.Freq < 0 {
+		return errors.New("FREQ is required")
+	}
+
+	hasOrdinals := slices.ContainsFunc(r.ByDay, func(day WeekdayNum) bool { return day.Ordinal != 0 })
+
+	if r.Freq == Weekly && len(r.ByMonthDay) > 0 {
+		return errors.New("BYMONTHDAY cannot be used with a WEEKLY rule")
+	}
+	if hasOrdinals && r.Freq != Monthly && r.Freq != Yearly {
+		return errors.New("BYDAY ordinals can only be used with MONTHLY and YEARLY rules")
+	}
+	if hasOrdinals && len(r.ByMonthDay) > 0 {
+		return errors.New("BYDAY ordinals cannot be combined with BYMONTHDAY")
+	}
+	if r.Freq == Yearly && len(r.ByDay) > 0 && len(r.ByMonth) == 0 {
+		return errors.New("BYDAY in a YEARLY rule requires BYMONTH")
+	}
+	if len(r.BySetPos) > 0 && len(r.ByMonth)+len(r.ByMonthDay)+len(r.ByDay) == 0 {
+		return errors.New("BYSETPOS requires BYMONTH, BYMONTHDAY or BYDAY")
+	}
+
+	return nil
+}
+
+func (r *Rule) normalize() {
+	slices.Sort(r.ByMonth)
+	r.ByMonth = slices.Compact(r.ByMonth)
+	slices.Sort(r.ByMonthDay)
+	r.ByMonthDay = slices.Compact(r.ByMonthDay)
+	slices.Sort(r.BySetPos)
+	r.BySetPos = slices.Compact(r.BySetPos)
+	slices.SortFunc(r.ByDay, func(a, b WeekdayNum) int {
+		if a.Ordinal != b.Ordinal {
+			return a.Ordinal - b.Ordinal
+		}
+		return int(isoWeekday(a.Weekday)) - int(isoWeekday(b.Weekday))
+	})
+	r.ByDay = slices.Compact(r.ByDay)
+}
+
+// String formats the rule in canonical form, so that equal rules have equal
+// strings.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + frequencyNames[r.Freq]}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByMonth) > 0 {
+		parts = append(parts, "BYMONTH="+joinInts(r.ByMonth))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(r.ByMonthDay))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = day.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.BySetPos) > 0 {
+		parts = append(parts, "BYSETPOS="+joinInts(r.BySetPos))
+	}
+	if r.Skip != Omit {
+		parts = append(parts, "SKIP="+skipNames[r.Skip])
+	}
+	return strings.Join(parts, ";")
+}
+
+func joinInts[T ~int](values []T) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.Itoa(int(value))
+	}
+	return strings.Join(parts, ",")
+}
+
+// isoWeekday numbers weekdays from Monday (0) to Sunday (6).
+func isoWeekday(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
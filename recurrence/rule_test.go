@@ -0,0 +1,277 @@
+package recurrence_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/recurrence"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(value string) time.Time {
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// occurrences returns the first n occurrences of rule on or after start.
+func occurrences(t *testing.T, rule string, start string, n int) []string {
+	t.Helper()
+
+	parsed, err := recurrence.Parse(rule)
+	require.NoError(t, err)
+
+	var result []string
+	next, ok := parsed.First(date(start))
+	for ; ok && len(result) < n; next, ok = parsed.Next(date(start), next) {
+		result = append(result, next.Format(time.DateOnly))
+	}
+	return result
+}
+
+func TestParseCanonicalForm(t *testing.T) {
+	cases := map[string]string{
+		"FREQ=MONTHLY":                                   "FREQ=MONTHLY",
+		"RRULE:freq=weekly;interval=2":                   "FREQ=WEEKLY;INTERVAL=2",
+		"FREQ=MONTHLY;INTERVAL=1;SKIP=OMIT":              "FREQ=MONTHLY",
+		"FREQ=MONTHLY;BYMONTHDAY=30,15,15;SKIP=backward": "FREQ=MONTHLY;BYMONTHDAY=15,30;SKIP=BACKWARD",
+		"FREQ=MONTHLY;BYDAY=FR,MO,TU;BYSETPOS=-1":        "FREQ=MONTHLY;BYDAY=MO,TU,FR;BYSETPOS=-1",
+		"FREQ=MONTHLY;BYDAY=-1FR,+2MO":                   "FREQ=MONTHLY;BYDAY=-1FR,2MO",
+		"FREQ=YEARLY;BYMONTH=12,3;BYMONTHDAY=-1":         "FREQ=YEARLY;BYMONTH=3,12;BYMONTHDAY=-1",
+		"FREQ=YEARLY;RSCALE=GREGORIAN;SKIP=FORWARD":      "FREQ=YEARLY;SKIP=FORWARD",
+	}
+
+	for input, expected := range cases {
+		rule, err := recurrence.Parse(input)
+		if assert.NoError(t, err, input) {
+			assert.Equal(t, expected, rule.String(), input)
+		}
+	}
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;INTERVAL=abc",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYMONTH=13",
+		"FREQ=MONTHLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYDAY=6MO",
+		"FREQ=MONTHLY;SKIP=SIDEWAYS",
+		"FREQ=MONTHLY;COUNT=3",
+		"FREQ=MONTHLY;UNTIL=20260101",
+		"FREQ=MONTHLY;RSCALE=HEBREW",
+		"FREQ=MONTHLY;FOO=BAR",
+		"FREQ=MONTHLY;BYSETPOS=1",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYMONTHDAY=1;BYDAY=1MO",
+		"FREQ=YEARLY;BYDAY=MO",
+		"FREQ",
+	} {
+		_, err := recurrence.Parse(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestSimpleFrequencies(t *testing.T) {
+	assert.Equal(t,
+		[]string{"2026-01-30", "2026-01-31", "2026-02-01"},
+		occurrences(t, "FREQ=DAILY", "2026-01-30", 3))
+	assert.Equal(t,
+		[]string{"2026-01-01", "2026-01-04", "2026-01-07"},
+		occurrences(t, "FREQ=DAILY;INTERVAL=3", "2026-01-01", 3))
+	assert.Equal(t,
+		[]string{"2026-01-01", "2026-01-15", "2026-01-29"},
+		occurrences(t, "FREQ=WEEKLY;INTERVAL=2", "2026-01-01", 3))
+	assert.Equal(t,
+		[]string{"2026-01-15", "2026-04-15", "2026-07-15", "2026-10-15", "2027-01-15"},
+		occurrences(t, "FREQ=MONTHLY;INTERVAL=3", "2026-01-15", 5))
+	assert.Equal(t,
+		[]string{"2026-03-10", "2027-03-10"},
+		occurrences(t, "FREQ=YEARLY", "2026-03-10", 2))
+}
+
+func TestWeeklyByDay(t *testing.T) {
+	// 2026-01-01 is a Thursday.
+	assert.Equal(t,
+		[]string{"2026-01-01", "2026-01-05", "2026-01-08", "2026-01-12"},
+		occurrences(t, "FREQ=WEEKLY;BYDAY=MO,TH", "2026-01-01", 4))
+	// The interval counts weeks from the week of the start date, so the
+	// Monday before the start is skipped rather than shifting the series.
+	assert.Equal(t,
+		[]string{"2026-01-02", "2026-01-12", "2026-01-16"},
+		occurrences(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", "2026-01-02", 3))
+}
+
+func TestMonthlyByMonthDay(t *testing.T) {
+	assert.Equal(t,
+		[]string{"2026-01-15", "2026-01-31", "2026-02-15", "2026-02-28", "2026-03-15"},
+		occurrences(t, "FREQ=MONTHLY;BYMONTHDAY=15,-1", "2026-01-10", 5))
+	assert.Equal(t,
+		[]string{"2026-01-30", "2026-02-27", "2026-03-30"},
+		occurrences(t, "FREQ=MONTHLY;BYMONTHDAY=-2", "2026-01-01", 3))
+}
+
+func TestMonthlyByDay(t *testing.T) {
+	assert.Equal(t,
+		[]string{"2026-01-12", "2026-02-09", "2026-03-09"},
+		occurrences(t, "FREQ=MONTHLY;BYDAY=2MO", "2026-01-01", 3))
+	assert.Equal(t,
+		[]string{"2026-01-30", "2026-02-27", "2026-03-27"},
+		occurrences(t, "FREQ=MONTHLY;BYDAY=-1FR", "2026-01-01", 3))
+	// Months with four Thursdays have no fifth one.
+	assert.Equal(t,
+		[]string{"2026-01-29", "2026-04-30", "2026-07-30"},
+		occurrences(t, "FREQ=MONTHLY;BYDAY=5TH", "2026-01-01", 3))
+}
+
+func TestLastBusinessDayOfMonth(t *testing.T) {
+	// 2026-01-31 is a Saturday and 2026-05-31 is a Sunday.
+	assert.Equal(t,
+		[]string{"2026-01-30", "2026-02-27", "2026-03-31", "2026-04-30", "2026-05-29"},
+		occurrences(t, "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", "2026-01-01", 5))
+}
+
+func TestFirstAndLastWeekdayOfMonth(t *testing.T) {
+	assert.Equal(t,
+		[]string{"2026-02-02", "2026-02-27", "2026-03-02", "2026-03-31"},
+		occurrences(t, "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=1,-1", "2026-02-01", 4))
+}
+
+func TestMonthDayFilteredByWeekday(t *testing.T) {
+	// Friday the 13th.
+	assert.Equal(t,
+		[]string{"2026-02-13", "2026-03-13", "2026-11-13"},
+		occurrences(t, "FREQ=MONTHLY;BYMONTHDAY=13;BYDAY=FR", "2026-01-01", 3))
+}
+
+func TestYearlyByMonth(t *testing.T) {
+	assert.Equal(t,
+		[]string{"2026-03-01", "2026-09-01", "2027-03-01"},
+		occurrences(t, "FREQ=YEARLY;BYMONTH=3,9", "2026-01-01", 3))
+	assert.Equal(t,
+		[]string{"2026-11-26", "2027-11-25"},
+		occurrences(t, "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH", "2026-01-01", 2))
+}
+
+func TestDailyFilters(t *testing.T) {
+	assert.Equal(t,
+		[]string{"2026-01-02", "2026-01-05", "2026-01-06"},
+		occurrences(t, "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR", "2026-01-02", 3))
+	assert.Equal(t,
+		[]string{"2026-01-31", "2026-02-28", "2026-03-31"},
+		occurrences(t, "FREQ=DAILY;BYMONTHDAY=-1", "2026-01-02", 3))
+}
+
+func TestClampingMonthEnd(t *testing.T) {
+	cases := []struct {
+		rule     string
+		start    string
+		expected []string
+	}{
+		// Without SKIP, months that have no 31st are left out.
+		{"FREQ=MONTHLY", "2026-01-31", []string{"2026-01-31", "2026-03-31", "2026-05-31", "2026-07-31"}},
+		{"FREQ=MONTHLY;SKIP=OMIT", "2026-01-31", []string{"2026-01-31", "2026-03-31", "2026-05-31", "2026-07-31"}},
+		// BACKWARD uses the last day of short months and returns to the 31st
+		// afterwards instead of drifting to the 28th.
+		{"FREQ=MONTHLY;SKIP=BACKWARD", "2026-01-31", []string{"2026-01-31", "2026-02-28", "2026-03-31", "2026-04-30"}},
+		// FORWARD moves to the first day of the following month.
+		{"FREQ=MONTHLY;SKIP=FORWARD", "2026-01-31", []string{"2026-01-31", "2026-03-01", "2026-03-31", "2026-05-01"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=15,30;SKIP=BACKWARD", "2026-02-01", []string{"2026-02-15", "2026-02-28", "2026-03-15", "2026-03-30"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=15,30", "2026-02-01", []string{"2026-02-15", "2026-03-15", "2026-03-30", "2026-04-15"}},
+		// Both the 30th and the 31st fall back to February 28, which is
+		// paid once.
+		{"FREQ=MONTHLY;BYMONTHDAY=30,31;SKIP=BACKWARD", "2026-02-01", []string{"2026-02-28", "2026-03-30", "2026-03-31", "2026-04-30"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=30,31;SKIP=FORWARD", "2026-02-01", []string{"2026-03-01", "2026-03-30", "2026-03-31", "2026-04-30"}},
+		// Counting from the end, the 30th-to-last day of February lies before
+		// its first day.
+		{"FREQ=MONTHLY;BYMONTHDAY=-30;SKIP=FORWARD", "2026-02-01", []string{"2026-02-01", "2026-03-02", "2026-04-01"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=-30;SKIP=BACKWARD", "2026-01-01", []string{"2026-01-02", "2026-01-31", "2026-03-02"}},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, occurrences(t, c.rule, c.start, len(c.expected)), c.rule)
+	}
+}
+
+func TestClampingLeapDay(t *testing.T) {
+	assert.Equal(t,
+		[]string{"2028-02-29", "2032-02-29", "2036-02-29"},
+		occurrences(t, "FREQ=YEARLY", "2028-02-29", 3))
+	assert.Equal(t,
+		[]string{"2028-02-29", "2029-02-28", "2030-02-28", "2031-02-28", "2032-02-29"},
+		occurrences(t, "FREQ=YEARLY;SKIP=BACKWARD", "2028-02-29", 5))
+	assert.Equal(t,
+		[]string{"2028-02-29", "2029-03-01", "2030-03-01", "2031-03-01", "2032-02-29"},
+		occurrences(t, "FREQ=YEARLY;SKIP=FORWARD", "2028-02-29", 5))
+}
+
+func TestStartIsOnlyAnOccurrenceWhenItMatches(t *testing.T) {
+	assert.Equal(t,
+		[]string{"2026-01-15", "2026-02-15"},
+		occurrences(t, "FREQ=MONTHLY;BYMONTHDAY=15", "2026-01-10", 2))
+	assert.Equal(t,
+		[]string{"2026-02-15"},
+		occurrences(t, "FREQ=MONTHLY;BYMONTHDAY=15", "2026-01-16", 1))
+}
+
+func TestNextJumpsAhead(t *testing.T) {
+	rule, err := recurrence.Parse("FREQ=WEEKLY;INTERVAL=2;BYDAY=MO")
+	require.NoError(t, err)
+
+	// 2020-01-06 is a Monday, so every other Monday from it falls on weeks
+	// with an even distance.
+	next, ok := rule.Next(date("2020-01-06"), date("2026-01-01"))
+	assert.True(t, ok)
+	assert.Equal(t, "2026-01-12", next.Format(time.DateOnly))
+
+	next, ok = rule.Next(date("2020-01-06"), date("2026-01-12"))
+	assert.True(t, ok)
+	assert.Equal(t, "2026-01-26", next.Format(time.DateOnly))
+}
+
+func TestNextIgnoresTimeOfDay(t *testing.T) {
+	rule, err := recurrence.Parse("FREQ=DAILY")
+	require.NoError(t, err)
+
+	start := time.Date(2026, time.January, 1, 23, 30, 0, 0, time.UTC)
+	next, ok := rule.Next(start, start)
+	assert.True(t, ok)
+	assert.Equal(t, date("2026-01-02"), next)
+}
+
+func TestRuleWithoutOccurrences(t *testing.T) {
+	rule, err := recurrence.Parse("FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30")
+	require.NoError(t, err)
+
+	_, ok := rule.First(date("2026-01-01"))
+	assert.False(t, ok)
+}
+
+func TestDescribe(t *testing.T) {
+	cases := map[string]string{
+		"FREQ=DAILY":                                    "daily",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO":               "every 2 weeks on Mon",
+		"FREQ=MONTHLY;INTERVAL=3":                       "every 3 months",
+		"FREQ=MONTHLY;BYMONTHDAY=15,-1":                 "monthly on the 15th, the last day",
+		"FREQ=MONTHLY;BYDAY=-1FR":                       "monthly on the last Fri",
+		"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1": "monthly on the last of Mon, Tue, Wed, Thu, Fri",
+		"FREQ=YEARLY;BYMONTH=11;BYDAY=4TH":              "yearly on the 4th Thu in Nov",
+	}
+
+	for input, expected := range cases {
+		rule, err := recurrence.Parse(input)
+		if assert.NoError(t, err, input) {
+			assert.Equal(t, expected, rule.Describe(), input)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Package scheduler runs periodic jobs so that every tick is executed by
+// exactly one replica and leaves a record in the job_runs table.
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron"
+	"github.com/sergeykhargelia/vct-project/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tickTolerance is how late a replica may fire and still agree with the
+// others on which tick it is running. It must be shorter than the period of
+// the most frequent job.
+const tickTolerance = 30 * time.Second
+
+// leaseTimeout is how long a run may stay running before another replica
+// takes it over, assuming the one that claimed it has crashed. It must be
+// longer than any job takes.
+const leaseTimeout = 15 * time.Minute
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+type Job func(scheduledAt time.Time) error
+
+type Scheduler struct {
+	DB   *gorm.DB
+	cron *cron.Cron
+}
+
+func New(db *gorm.DB) *Scheduler {
+	return &Scheduler{DB: db, cron: cron.New()}
+}
+
+// Register adds a job that runs on a standard five-field cron spec.
+func (s *Scheduler) Register(name, spec string, job Job) error {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for job %s: %w", name, err)
+	}
+
+	s.cron.Schedule(schedule, cron.FuncJob(func() {
+		scheduledAt := schedule.Next(time.Now().Add(-tickTolerance))
+		if _, err := s.Run(name, scheduledAt, job); err != nil {
+			log.Printf("Job %s scheduled at %s failed: %v", name, scheduledAt.Format(time.RFC3339), err)
+		}
+	}))
+
+	return nil
+}
+
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+func (s *Scheduler) Stop() {
+	s.cron.Stop()
+}
+
+// Run executes job for the tick scheduledAt unless another replica has
+// already claimed it. The job_runs row for the tick acts as a lease: only the
+// replica that manages to insert it runs the job. A run still marked running
+// after leaseTimeout is taken over, so that a crash does not leave the tick
+// unfinished for good. Run reports whether the job was executed by this call.
+func (s *Scheduler) Run(name string, scheduledAt time.Time, job Job) (bool, error) {
+	run := model.JobRun{
+		Job:         name,
+		ScheduledAt: scheduledAt,
+		StartedAt:   time.Now(),
+		Status:      model.JobRunRunning,
+	}
+
+	result := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&run)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim job run: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		taken, err := s.takeOver(&run)
+		if err != nil || !taken {
+			return false, err
+		}
+	}
+
+	jobErr := runRecovered(job, scheduledAt)
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = model.JobRunSucceeded
+	if jobErr != nil {
+		run.Status = model.JobRunFailed
+		run.Error = jobErr.Error()
+	}
+
+	if err := s.DB.Save(&run).Error; err != nil {
+		return true, fmt.Errorf("failed to record job run: %w", err)
+	}
+
+	return true, jobErr
+}
+
+// takeOver claims the run of the same job and tick when its lease has
+// expired, loading it into run. Replicas racing for it are serialized by the
+// row lock of the update, and only the first one sees the lease expired.
+func (s *Scheduler) takeOver(run *model.JobRun) (bool, error) {
+	result := s.DB.Model(&model.JobRun{}).
+		Where("job = ? AND scheduled_at = ? AND status = ? AND started_at < ?",
+			run.Job, run.ScheduledAt, model.JobRunRunning, run.StartedAt.Add(-leaseTimeout)).
+		Update("started_at", run.StartedAt)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to take over job run: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	log.Printf("Job %s scheduled at %s: taking over an expired run", run.Job, run.ScheduledAt.Format(time.RFC3339))
+	if err := s.DB.Where("job = ? AND scheduled_at = ?", run.Job, run.ScheduledAt).First(run).Error; err != nil {
+		return false, fmt.Errorf("failed to take over job run: %w", err)
+	}
+
+	return true, nil
+}
+
+func runRecovered(job Job, scheduledAt time.Time) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return job(scheduledAt)
+}
+
+// History returns the most recent runs, newest first. An empty name returns
+// runs of every job.
+func (s *Scheduler) History(name string, limit int) ([]model.JobRun, error) {
+	query := s.DB.Order("scheduled_at desc").Limit(limit)
+	if name != "" {
+		query = query.Where("job = ?", name)
+	}
+
+	var runs []model.JobRun
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// Prune deletes the runs scheduled before before and returns how many there
+// were.
+func (s *Scheduler) Prune(before time.Time) (int64, error) {
+	result := s.DB.Where("scheduled_at < ?", before).Delete(&model.JobRun{})
+	return result.RowsAffected, result.Error
+}
+
+// HistoryHandler serves the most recent runs of every job as JSON. The
+// history is not per user, so it is only served on the internal port next to
+// the metrics.
+func (s *Scheduler) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultHistoryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxHistoryLimit {
+			http.Error(w, fmt.Sprintf("Limit should be a number from 1 to %d", maxHistoryLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	runs, err := s.History(r.URL.Query().Get("job"), limit)
+	if err != nil {
+		http.Error(w, "Error while finding job runs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(runs)
+}
@@ -0,0 +1,170 @@
+package scheduler_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sergeykhargelia/vct-project/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var tick = time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+func initTestScheduler(t *testing.T) (*scheduler.Scheduler, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { mockDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: mockDB, DriverName: "postgres"}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+
+	return scheduler.New(db), mock
+}
+
+func TestRunRecordsSuccess(t *testing.T) {
+	sch, mock := initTestScheduler(t)
+
+	mock.ExpectQuery(`INSERT INTO "job_runs" .* ON CONFLICT DO NOTHING RETURNING "id"`).
+		WithArgs("payments", tick, sqlmock.AnyArg(), nil, "running", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`UPDATE "job_runs" SET .* WHERE "id" = \$7`).
+		WithArgs("payments", tick, sqlmock.AnyArg(), sqlmock.AnyArg(), "succeeded", "", uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var ranAt time.Time
+	ran, err := sch.Run("payments", tick, func(scheduledAt time.Time) error {
+		ranAt = scheduledAt
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, tick, ranAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunRecordsFailureAndPanic(t *testing.T) {
+	table := []struct {
+		name    string
+		job     scheduler.Job
+		message string
+	}{
+		{"error", func(time.Time) error { return errors.New("database is down") }, "database is down"},
+		{"panic", func(time.Time) error { panic("nil map") }, "job panicked: nil map"},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			sch, mock := initTestScheduler(t)
+
+			mock.ExpectQuery(`INSERT INTO "job_runs"`).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			mock.ExpectExec(`UPDATE "job_runs" SET .* WHERE "id" = \$7`).
+				WithArgs("payments", tick, sqlmock.AnyArg(), sqlmock.AnyArg(), "failed", params.message, uint64(1)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			ran, err := sch.Run("payments", tick, params.job)
+
+			assert.EqualError(t, err, params.message)
+			assert.True(t, ran)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRunSkipsTickClaimedByAnotherReplica(t *testing.T) {
+	sch, mock := initTestScheduler(t)
+
+	mock.ExpectQuery(`INSERT INTO "job_runs" .* ON CONFLICT DO NOTHING`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	// The other replica started less than the lease timeout ago.
+	mock.ExpectExec(`UPDATE "job_runs" SET "started_at"=\$1 WHERE .*started_at < \$5`).
+		WithArgs(sqlmock.AnyArg(), "payments", tick, "running", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ran, err := sch.Run("payments", tick, func(time.Time) error {
+		t.Fatal("job run twice for the same tick")
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.False(t, ran)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunTakesOverExpiredLease(t *testing.T) {
+	sch, mock := initTestScheduler(t)
+
+	mock.ExpectQuery(`INSERT INTO "job_runs" .* ON CONFLICT DO NOTHING`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(`UPDATE "job_runs" SET "started_at"=\$1 WHERE .*started_at < \$5`).
+		WithArgs(sqlmock.AnyArg(), "payments", tick, "running", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT \* FROM "job_runs" WHERE job = \$1 AND scheduled_at = \$2`).
+		WithArgs("payments", tick, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "job", "scheduled_at", "started_at", "status"}).
+			AddRow(7, "payments", tick, time.Now(), "running"))
+	mock.ExpectExec(`UPDATE "job_runs" SET .* WHERE "id" = \$7`).
+		WithArgs("payments", tick, sqlmock.AnyArg(), sqlmock.AnyArg(), "succeeded", "", uint64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ran, err := sch.Run("payments", tick, func(time.Time) error { return nil })
+
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPrune(t *testing.T) {
+	sch, mock := initTestScheduler(t)
+
+	mock.ExpectExec(`DELETE FROM "job_runs" WHERE scheduled_at < \$1`).
+		WithArgs(tick).
+		WillReturnResult(sqlmock.NewResult(0, 1440))
+
+	pruned, err := sch.Prune(tick)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1440), pruned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHistoryHandler(t *testing.T) {
+	sch, mock := initTestScheduler(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "job_runs" WHERE job = \$1 ORDER BY scheduled_at desc LIMIT \$2`).
+		WithArgs("payments", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "job", "scheduled_at", "status"}).
+			AddRow(2, "payments", tick, "succeeded").
+			AddRow(1, "payments", tick.AddDate(0, 0, -1), "failed"))
+
+	w := httptest.NewRecorder()
+	sch.HistoryHandler(w, httptest.NewRequest(http.MethodGet, "/job_runs?job=payments&limit=2", nil))
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), `"Status":"failed"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHistoryHandlerRejectsInvalidLimit(t *testing.T) {
+	for _, limit := range []string{"0", "-1", "many", "201"} {
+		sch, mock := initTestScheduler(t)
+
+		w := httptest.NewRecorder()
+		sch.HistoryHandler(w, httptest.NewRequest(http.MethodGet, "/job_runs?limit="+limit, nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, limit)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
@@ -0,0 +1,334 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"gorm.io/gorm"
+)
+
+// Error codes of the JSON API, sent in the error envelope next to a message
+// meant for people.
+const (
+	codeInvalidRequest   = "invalid_request"
+	codeValidationFailed = "validation_failed"
+	codeUnauthenticated  = "unauthenticated"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeConflict         = "conflict"
+	codeInternal         = "internal_error"
+)
+
+const (
+	// maxAPIBodySize limits the size of JSON request bodies.
+	maxAPIBodySize = 1 << 20
+
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// apiError is the envelope every error of the JSON API is wrapped in.
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiPage is a page of a list returned by the JSON API. Total is the number
+// of items on all pages.
+type apiPage[T any] struct {
+	Items  []T   `json:"items"`
+	Total  int64 `json:"total"`
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiError{Error: apiErrorDetail{Code: code, Message: message}})
+}
+
+// writeServiceError responds with the status fitting an error returned by a
+// service function. Only the messages of service errors reach the client,
+// any other error is logged and reported as an internal error.
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch errorKindOf(err) {
+	case kindInvalid:
+		writeAPIError(w, http.StatusUnprocessableEntity, codeValidationFailed, err.Error())
+	case kindConflict:
+		writeAPIError(w, http.StatusConflict, codeConflict, err.Error())
+	case kindUnauthorized:
+		writeAPIError(w, http.StatusUnauthorized, codeUnauthenticated, err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, codeInternal, publicMessage(err))
+	}
+}
+
+// writeLookupError reports an error returned by findOwned, like
+// renderLookupError does for the HTMX UI.
+func writeLookupError(w http.ResponseWriter, res resource, err error) {
+	title := strings.ToUpper(res.name[:1]) + res.name[1:]
+
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		writeAPIError(w, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+	case errors.Is(err, errInvalidID):
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid "+res.name+" id")
+	case errors.Is(err, errNotFound):
+		writeAPIError(w, http.StatusNotFound, codeNotFound, title+" not found")
+	default:
+		logFailure("Failed to find "+res.name, err)
+		writeAPIError(w, http.StatusInternalServerError, codeInternal, "Failed to find "+res.name)
+	}
+}
+
+// APINotFound and APIMethodNotAllowed answer requests to the JSON API that
+// match no route with the error envelope.
+func APINotFound(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, codeNotFound, "No such endpoint")
+}
+
+func APIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+}
+
+// decodeAPIForm decodes the JSON object in the request body into the form
+// values the service functions take, so that the API validates input exactly
+// like the HTMX forms do. fields maps the accepted JSON keys to form field
+// names. Numbers are kept as written, arrays are joined with commas and null
+// stands for an empty value, which clears optional fields.
+func decodeAPIForm(w http.ResponseWriter, r *http.Request, fields map[string]string) (url.Values, error) {
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodySize)).Decode(&body); err != nil {
+		return nil, errors.New("Request body should be a JSON object")
+	}
+
+	form := url.Values{}
+	for key, raw := range body {
+		name, ok := fields[key]
+		if !ok {
+			return nil, fmt.Errorf("Unknown field %q", key)
+		}
+
+		value, err := formValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Field %q should be a string, a number or an array of them", key)
+		}
+		form.Set(name, value)
+	}
+
+	return form, nil
+}
+
+func formValue(raw json.RawMessage) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case []any:
+		parts := make([]string, len(value))
+		for i, element := range value {
+			switch element := element.(type) {
+			case string:
+				parts[i] = element
+			case json.Number:
+				parts[i] = element.String()
+			default:
+				return "", errors.New("unsupported array element")
+			}
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return "", errors.New("unsupported value")
+	}
+}
+
+// parsePage reads the limit and offset query parameters of a list request.
+func parsePage(r *http.Request) (limit, offset int, err error) {
+	limit = defaultPageLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf("Limit should be a number from 1 to %d", maxPageLimit)
+		}
+	}
+
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("Offset should be a non-negative number")
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// apiUser is a user as returned by the JSON API. The password hash and the
+// calendar token are never sent.
+type apiUser struct {
+	ID                     uint64   `json:"id"`
+	Name                   string   `json:"name"`
+	Email                  string   `json:"email"`
+	BaseCurrency           string   `json:"baseCurrency"`
+	NotificationChannels   []string `json:"notificationChannels"`
+	DefaultReminderOffsets []int    `json:"defaultReminderOffsets"`
+}
+
+func newAPIUser(u model.User) apiUser {
+	offsets, _ := model.ParseReminderOffsets(u.DefaultReminderOffsets)
+	return apiUser{
+		ID:                     u.ID,
+		Name:                   u.Name,
+		Email:                  u.Email,
+		BaseCurrency:           u.BaseCurrency,
+		NotificationChannels:   nonNil(u.Channels()),
+		DefaultReminderOffsets: nonNil(offsets),
+	}
+}
+
+// nonNil makes empty lists encode as [] rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// formFieldsOf maps the JSON keys of the request struct v to the form fields
+// decodeAPIForm fills, named by the form tag or else like the JSON key. The
+// request structs are what the OpenAPI document describes request bodies by.
+func formFieldsOf(v any) map[string]string {
+	fields := map[string]string{}
+	t := reflect.TypeOf(v)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		name := field.Tag.Get("form")
+		if name == "" {
+			name = key
+		}
+		fields[key] = name
+	}
+	return fields
+}
+
+type registerRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+var registerFields = formFieldsOf(registerRequest{})
+
+// APIRegister creates a user. It does not log them in: a token is issued by
+// APICreateToken.
+func (s *Server) APIRegister(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	form, err := decodeAPIForm(w, r, registerFields)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	user, err := s.registerUser(form.Get("name"), form.Get("email"), form.Get("password"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/users/me")
+	writeJSON(w, http.StatusCreated, newAPIUser(user))
+}
+
+type tokenRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+var tokenFields = formFieldsOf(tokenRequest{})
+
+type apiToken struct {
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expiresAt" format:"date-time"`
+}
+
+// APICreateToken exchanges an email and a password for a session token to be
+// sent in the Authorization header as "Bearer <token>".
+func (s *Server) APICreateToken(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	form, err := decodeAPIForm(w, r, tokenFields)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	user, err := s.authenticate(form.Get("email"), form.Get("password"))
+	if err != nil {
+		// Whether the email is registered is not given away.
+		if errorKindOf(err) == kindUnauthorized {
+			err = unauthorized("Wrong email or password")
+		}
+		writeServiceError(w, err)
+		return
+	}
+
+	token, expiresAt, err := issueToken(user.ID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, apiToken{Token: token, ExpiresAt: expiresAt.UTC().Format(time.RFC3339)})
+}
+
+// APICurrentUser returns the authenticated user.
+func (s *Server) APICurrentUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+		return
+	}
+
+	var user model.User
+	err := s.DB.First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeAPIError(w, http.StatusUnauthorized, codeUnauthenticated, "User does not exist")
+		return
+	}
+	if err != nil {
+		writeServiceError(w, failure("Failed to find user", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAPIUser(user))
+}
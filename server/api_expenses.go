@@ -0,0 +1,454 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"gorm.io/gorm"
+)
+
+// apiRegularExpense is a regular expense as returned by the JSON API.
+// Amounts are decimal strings in the currency of the regular expense.
+type apiRegularExpense struct {
+	ID          uint64  `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Amount      string  `json:"amount"`
+	Currency    string  `json:"currency"`
+	Recurrence  string  `json:"recurrence"`
+	StartDate   string  `json:"startDate" format:"date"`
+	NextDate    *string `json:"nextDate" format:"date"`
+	EndDate     *string `json:"endDate" format:"date"`
+	// ReminderOffsets is empty when the user's default offsets are used.
+	ReminderOffsets   []int             `json:"reminderOffsets"`
+	MaxOccurrences    *uint             `json:"maxOccurrences"`
+	OccurrenceCount   uint              `json:"occurrenceCount"`
+	TrialEndsOn       *string           `json:"trialEndsOn" format:"date"`
+	PostTrialAmount   *string           `json:"postTrialAmount"`
+	TrialReminderDays *uint             `json:"trialReminderDays"`
+	PausedFrom        *string           `json:"pausedFrom" format:"date"`
+	PausedUntil       *string           `json:"pausedUntil" format:"date"`
+	Status            string            `json:"status"`
+	CancelledAt       *time.Time        `json:"cancelledAt"`
+	CategoryID        *uint64           `json:"categoryId"`
+	Category          *string           `json:"category"`
+	Tags              []string          `json:"tags"`
+	AmountChanges     []apiAmountChange `json:"amountChanges"`
+}
+
+type apiAmountChange struct {
+	EffectiveDate string `json:"effectiveDate" format:"date"`
+	Amount        string `json:"amount"`
+}
+
+// dateOnly is model.DateOnly for optional dates.
+func dateOnly(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	date := model.DateOnly(*value)
+	return &date
+}
+
+func newAPIRegularExpense(e model.RegularExpense) apiRegularExpense {
+	offsets, _ := model.ParseReminderOffsets(e.ReminderOffsets)
+
+	result := apiRegularExpense{
+		ID:              e.ID,
+		Name:            e.Name,
+		Description:     e.Description,
+		Amount:          e.Amount.Decimal(),
+		Currency:        e.Amount.Currency,
+		Recurrence:      e.Recurrence,
+		StartDate:       model.DateOnly(e.StartDate),
+		NextDate:        dateOnly(e.NextDate),
+		EndDate:         dateOnly(e.EndDate),
+		ReminderOffsets: nonNil(offsets),
+		MaxOccurrences:  e.MaxOccurrences,
+		OccurrenceCount: e.OccurrenceCount,
+		TrialEndsOn:     dateOnly(e.TrialEndsOn),
+		PausedFrom:      dateOnly(e.PausedFrom),
+		PausedUntil:     dateOnly(e.PausedUntil),
+		Status:          e.Status,
+		CancelledAt:     e.CancelledAt,
+		CategoryID:      e.CategoryID,
+		Tags:            nonNil(model.SplitTags(e.Tags)),
+		AmountChanges:   []apiAmountChange{},
+	}
+
+	if e.TrialEndsOn != nil {
+		postTrialAmount := e.PostTrialPrice().Decimal()
+		result.PostTrialAmount = &postTrialAmount
+		result.TrialReminderDays = &e.TrialReminderDays
+	}
+
+	if e.Category != nil {
+		result.Category = &e.Category.Name
+	}
+
+	for _, change := range e.AmountChanges {
+		result.AmountChanges = append(result.AmountChanges, apiAmountChange{
+			EffectiveDate: model.DateOnly(change.EffectiveDate),
+			Amount:        model.Money{Minor: change.Amount, Currency: e.Amount.Currency}.Decimal(),
+		})
+	}
+
+	return result
+}
+
+// apiExpense is an expense as returned by the JSON API.
+type apiExpense struct {
+	ID               uint64   `json:"id"`
+	Date             string   `json:"date" format:"date"`
+	Name             string   `json:"name"`
+	Amount           string   `json:"amount"`
+	Currency         string   `json:"currency"`
+	CategoryID       *uint64  `json:"categoryId"`
+	Category         *string  `json:"category"`
+	Tags             []string `json:"tags"`
+	RegularExpenseID *uint64  `json:"regularExpenseId"`
+}
+
+func newAPIExpense(e model.Expense) apiExpense {
+	result := apiExpense{
+		ID:               e.ID,
+		Date:             model.DateOnly(e.Date),
+		Name:             e.Name,
+		Amount:           e.Amount.Decimal(),
+		Currency:         e.Amount.Currency,
+		CategoryID:       e.CategoryID,
+		Tags:             nonNil(model.SplitTags(e.Tags)),
+		RegularExpenseID: e.RegularExpenseID,
+	}
+
+	if e.Category != nil {
+		result.Category = &e.Category.Name
+	}
+
+	return result
+}
+
+// regularExpenseRequest is the body of requests creating or updating a
+// regular expense. Creating one takes at least name, amount and nextDate;
+// updates change only the fields present. Amounts may be sent as numbers or
+// decimal strings.
+type regularExpenseRequest struct {
+	Name                string   `json:"name,omitempty"`
+	Description         string   `json:"description,omitempty"`
+	Amount              string   `json:"amount,omitempty"`
+	Currency            string   `json:"currency,omitempty"`
+	AmountEffectiveDate string   `json:"amountEffectiveDate,omitempty" format:"date"`
+	Recurrence          string   `json:"recurrence,omitempty"`
+	NextDate            string   `json:"nextDate,omitempty" format:"date"`
+	EndDate             *string  `json:"endDate,omitempty" format:"date"`
+	MaxOccurrences      *uint    `json:"maxOccurrences,omitempty"`
+	ReminderOffsets     []int    `json:"reminderOffsets,omitempty"`
+	TrialEndsOn         *string  `json:"trialEndsOn,omitempty" format:"date"`
+	PostTrialAmount     string   `json:"postTrialAmount,omitempty"`
+	TrialReminderDays   *uint    `json:"trialReminderDays,omitempty"`
+	CategoryID          *uint64  `json:"categoryId,omitempty" form:"category"`
+	Tags                []string `json:"tags,omitempty"`
+}
+
+var regularExpenseFields = formFieldsOf(regularExpenseRequest{})
+
+// expenseRequest is the body of requests creating or updating a one-off
+// expense. Creating one takes at least name, amount and date.
+type expenseRequest struct {
+	Name       string   `json:"name,omitempty"`
+	Date       string   `json:"date,omitempty" format:"date"`
+	Amount     string   `json:"amount,omitempty"`
+	Currency   string   `json:"currency,omitempty"`
+	CategoryID *uint64  `json:"categoryId,omitempty" form:"category"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+var expenseFields = formFieldsOf(expenseRequest{})
+
+func preloadAmountChanges(db *gorm.DB) *gorm.DB {
+	return db.Order("effective_date asc")
+}
+
+// writeRegularExpense responds with the regular expense with id, loaded
+// afresh together with its category and pending amount changes.
+func (s *Server) writeRegularExpense(w http.ResponseWriter, status int, id uint64) {
+	var regularExpense model.RegularExpense
+	err := s.DB.Preload("Category").Preload("AmountChanges", preloadAmountChanges).First(&regularExpense, id).Error
+	if err != nil {
+		writeServiceError(w, failure("Failed to find regular expense", err))
+		return
+	}
+
+	writeJSON(w, status, newAPIRegularExpense(regularExpense))
+}
+
+// writeExpense responds with the expense with id, loaded afresh together with
+// its category.
+func (s *Server) writeExpense(w http.ResponseWriter, status int, id uint64) {
+	var expense model.Expense
+	if err := s.DB.Preload("Category").First(&expense, id).Error; err != nil {
+		writeServiceError(w, failure("Failed to find expense", err))
+		return
+	}
+
+	writeJSON(w, status, newAPIExpense(expense))
+}
+
+// APIListRegularExpenses lists the user's regular expenses with the status
+// given in the query string, active ones by default, optionally filtered by
+// category and tag. Active regular expenses come in the order of their next
+// payment, stopped ones most recently created first.
+func (s *Server) APIListRegularExpenses(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+		return
+	}
+
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	order := "next_date, id"
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = model.RegularExpenseActive
+	case model.RegularExpenseActive:
+	case model.RegularExpenseEnded, model.RegularExpenseCancelled:
+		order = "id DESC"
+	default:
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid status")
+		return
+	}
+
+	query, err := filterByCategoryAndTag(s.DB.Model(&model.RegularExpense{}).Where("user_id = ? AND status = ?", userID, status), r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	page := apiPage[apiRegularExpense]{Items: []apiRegularExpense{}, Limit: limit, Offset: offset}
+	if err := query.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+		writeServiceError(w, failure("Error while finding regular expenses", err))
+		return
+	}
+
+	var regularExpenses []model.RegularExpense
+	err = query.Preload("Category").Preload("AmountChanges", preloadAmountChanges).
+		Order(order).Limit(limit).Offset(offset).Find(&regularExpenses).Error
+	if err != nil {
+		writeServiceError(w, failure("Error while finding regular expenses", err))
+		return
+	}
+
+	for _, e := range regularExpenses {
+		page.Items = append(page.Items, newAPIRegularExpense(e))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) APICreateRegularExpense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+		return
+	}
+
+	form, err := decodeAPIForm(w, r, regularExpenseFields)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	regularExpense, err := s.createRegularExpense(userID, form)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/regular_expenses/%d", regularExpense.ID))
+	s.writeRegularExpense(w, http.StatusCreated, regularExpense.ID)
+}
+
+// APIGetRegularExpense returns a regular expense of the user, whatever its
+// status.
+func (s *Server) APIGetRegularExpense(w http.ResponseWriter, r *http.Request) {
+	var regularExpense model.RegularExpense
+	if err := s.findOwned(r, regularExpenseResource, &regularExpense); err != nil {
+		writeLookupError(w, regularExpenseResource, err)
+		return
+	}
+
+	s.writeRegularExpense(w, http.StatusOK, regularExpense.ID)
+}
+
+// APIUpdateRegularExpense changes the fields present in the request body of
+// an active regular expense. Fields set to null are cleared.
+func (s *Server) APIUpdateRegularExpense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var regularExpense model.RegularExpense
+	if err := s.findOwned(r, regularExpenseResource, &regularExpense, activeRegularExpense); err != nil {
+		writeLookupError(w, regularExpenseResource, err)
+		return
+	}
+
+	form, err := decodeAPIForm(w, r, regularExpenseFields)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	if err := s.updateRegularExpense(regularExpense, form); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	s.writeRegularExpense(w, http.StatusOK, regularExpense.ID)
+}
+
+// APIDeleteRegularExpense cancels an active regular expense, which stays in
+// the history with status cancelled.
+func (s *Server) APIDeleteRegularExpense(w http.ResponseWriter, r *http.Request) {
+	var regularExpense model.RegularExpense
+	if err := s.findOwned(r, regularExpenseResource, &regularExpense, activeRegularExpense); err != nil {
+		writeLookupError(w, regularExpenseResource, err)
+		return
+	}
+
+	if err := s.cancelRegularExpense(regularExpense); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIListExpenses lists the user's expenses, latest first, optionally limited
+// to start_date and end_date and filtered by category and tag.
+func (s *Server) APIListExpenses(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+		return
+	}
+
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	query, err := filterByDate(s.DB.Model(&model.Expense{}).Where("user_id = ?", userID), r)
+	if err == nil {
+		query, err = filterByCategoryAndTag(query, r)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	page := apiPage[apiExpense]{Items: []apiExpense{}, Limit: limit, Offset: offset}
+	if err := query.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+		writeServiceError(w, failure("Error while finding expenses", err))
+		return
+	}
+
+	var expenses []model.Expense
+	err = query.Preload("Category").Order("date DESC, id DESC").Limit(limit).Offset(offset).Find(&expenses).Error
+	if err != nil {
+		writeServiceError(w, failure("Error while finding expenses", err))
+		return
+	}
+
+	for _, e := range expenses {
+		page.Items = append(page.Items, newAPIExpense(e))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) APICreateExpense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+		return
+	}
+
+	form, err := decodeAPIForm(w, r, expenseFields)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	id, err := s.createExpense(userID, form)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/expenses/%d", id))
+	s.writeExpense(w, http.StatusCreated, id)
+}
+
+// APIGetExpense returns an expense of the user, including occurrences of
+// regular expenses.
+func (s *Server) APIGetExpense(w http.ResponseWriter, r *http.Request) {
+	var expense model.Expense
+	if err := s.findOwned(r, expenseResource, &expense); err != nil {
+		writeLookupError(w, expenseResource, err)
+		return
+	}
+
+	s.writeExpense(w, http.StatusOK, expense.ID)
+}
+
+// APIUpdateExpense changes the fields present in the request body of a
+// one-off expense.
+func (s *Server) APIUpdateExpense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var expense model.Expense
+	if err := s.findOwned(r, expenseResource, &expense, oneOffExpense); err != nil {
+		writeLookupError(w, expenseResource, err)
+		return
+	}
+
+	form, err := decodeAPIForm(w, r, expenseFields)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	if err := s.updateExpense(expense, form); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	s.writeExpense(w, http.StatusOK, expense.ID)
+}
+
+func (s *Server) APIDeleteExpense(w http.ResponseWriter, r *http.Request) {
+	var expense model.Expense
+	if err := s.findOwned(r, expenseResource, &expense, oneOffExpense); err != nil {
+		writeLookupError(w, expenseResource, err)
+		return
+	}
+
+	if err := s.deleteExpense(expense); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,270 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/sergeykhargelia/vct-project/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type apiError struct {
+	Error struct {
+		Code    string
+		Message string
+	}
+}
+
+func newAPIRequest(method, target string, userID uint64, vars map[string]string, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = mux.SetURLVars(req, vars)
+	return req.WithContext(context.WithValue(req.Context(), "user_id", userID))
+}
+
+func decodeAPIError(t *testing.T, w *httptest.ResponseRecorder) apiError {
+	t.Helper()
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var body apiError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	return body
+}
+
+func TestAPITokenAuthenticatesRequests(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE email = \$1`).
+		WithArgs("first@example.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password_hash"}).AddRow(ownerID, "first@example.com", string(hash)))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tokens", strings.NewReader(`{"email": "first@example.com", "password": "secret"}`))
+	w := httptest.NewRecorder()
+	s.APICreateToken(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode)
+	var token struct{ Token string }
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&token))
+
+	var userID uint64
+	handler := server.APIAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		userID = r.Context().Value("user_id").(uint64)
+	})
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/users/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, ownerID, userID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIRejectsMissingToken(t *testing.T) {
+	handler := server.APIAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler called without a token")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/me", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	assert.Equal(t, "unauthenticated", decodeAPIError(t, w).Error.Code)
+}
+
+func TestAPIWrongPasswordIsUnauthorized(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE email = \$1`).
+		WithArgs("first@example.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tokens", strings.NewReader(`{"email": "first@example.com", "password": "guess"}`))
+	w := httptest.NewRecorder()
+	s.APICreateToken(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	assert.Equal(t, "Wrong email or password", decodeAPIError(t, w).Error.Message)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIRegisterRejectsTakenEmail(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE email = \$1`).
+		WithArgs("first@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(`{"name": "First", "email": "first@example.com", "password": "secret"}`))
+	w := httptest.NewRecorder()
+	s.APIRegister(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Result().StatusCode)
+	assert.Equal(t, "conflict", decodeAPIError(t, w).Error.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIInternalErrorsAreLoggedNotSent(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE email = \$1`).
+		WithArgs("first@example.com").
+		WillReturnError(errors.New(`pq: relation "users" does not exist`))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(`{"name": "First", "email": "first@example.com", "password": "secret"}`))
+	w := httptest.NewRecorder()
+	s.APIRegister(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+	body := decodeAPIError(t, w)
+	assert.Equal(t, "internal_error", body.Error.Code)
+	assert.Equal(t, "Error while creating user", body.Error.Message)
+	assert.Contains(t, logged.String(), `Error while creating user: pq: relation "users" does not exist`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPICreateExpense(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "base_currency"}).AddRow(ownerID, "RUB"))
+	mock.ExpectQuery(`INSERT INTO "expenses" .* RETURNING "id"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery(`SELECT \* FROM "expenses" WHERE "expenses"."id" = \$1`).
+		WithArgs(uint64(5), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "date", "name", "amount", "currency", "tags"}).
+			AddRow(5, ownerID, "2026-01-05", "Headphones", 1299000, "RUB", "gift,music"))
+
+	body := `{"name": "Headphones", "amount": 12990, "date": "2026-01-05", "tags": ["Gift", "music"]}`
+	req := newAPIRequest(http.MethodPost, "/api/v1/expenses", ownerID, nil, body)
+	w := httptest.NewRecorder()
+	s.APICreateExpense(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
+	assert.Equal(t, "/api/v1/expenses/5", w.Header().Get("Location"))
+	assert.JSONEq(t, `{
+		"id": 5,
+		"date": "2026-01-05",
+		"name": "Headphones",
+		"amount": "12990.00",
+		"currency": "RUB",
+		"categoryId": null,
+		"category": null,
+		"tags": ["gift", "music"],
+		"regularExpenseId": null
+	}`, w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIValidationErrors(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	table := []struct {
+		name    string
+		body    string
+		status  int
+		code    string
+		message string
+	}{
+		{"invalid amount", `{"name": "Headphones", "amount": "lots", "currency": "RUB", "date": "2026-01-05"}`, http.StatusUnprocessableEntity, "validation_failed", "Failed to parse amount"},
+		{"unknown field", `{"name": "Headphones", "price": 1}`, http.StatusBadRequest, "invalid_request", `Unknown field "price"`},
+		{"not an object", `[1, 2]`, http.StatusBadRequest, "invalid_request", "Request body should be a JSON object"},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			req := newAPIRequest(http.MethodPost, "/api/v1/expenses", ownerID, nil, params.body)
+			w := httptest.NewRecorder()
+			s.APICreateExpense(w, req)
+
+			assert.Equal(t, params.status, w.Result().StatusCode)
+			body := decodeAPIError(t, w)
+			assert.Equal(t, params.code, body.Error.Code)
+			assert.Equal(t, params.message, body.Error.Message)
+		})
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIListExpensesIsPaginated(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "expenses" WHERE user_id = \$1 AND date >= \$2`).
+		WithArgs(ownerID, "2026-01-01").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`SELECT \* FROM "expenses" WHERE user_id = \$1 AND date >= \$2 ORDER BY date DESC, id DESC LIMIT \$3 OFFSET \$4`).
+		WithArgs(ownerID, "2026-01-01", 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "date", "name", "amount", "currency"}).
+			AddRow(1, ownerID, "2026-01-05", "Coffee", 25000, "RUB"))
+
+	req := newAPIRequest(http.MethodGet, "/api/v1/expenses?start_date=2026-01-01&limit=2&offset=2", ownerID, nil, "")
+	w := httptest.NewRecorder()
+	s.APIListExpenses(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var page struct {
+		Items  []struct{ ID uint64 }
+		Total  int64
+		Limit  int
+		Offset int
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Len(t, page.Items, 1)
+	assert.Equal(t, int64(3), page.Total)
+	assert.Equal(t, 2, page.Limit)
+	assert.Equal(t, 2, page.Offset)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIRejectsInvalidPage(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	req := newAPIRequest(http.MethodGet, "/api/v1/regular_expenses?limit=1000", ownerID, nil, "")
+	w := httptest.NewRecorder()
+	s.APIListRegularExpenses(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.Equal(t, "invalid_request", decodeAPIError(t, w).Error.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIDeleteRegularExpense(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(id = \$1 AND user_id = \$2\) AND status = 'active\'`).
+		WithArgs(uint64(7), ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "next_date"}).AddRow(7, ownerID, "2026-01-01"))
+	mock.ExpectExec(`UPDATE "regular_expenses" SET "cancelled_at"=\$1,"status"=\$2 WHERE "id" = \$3`).
+		WithArgs(sqlmock.AnyArg(), "cancelled", uint64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := newAPIRequest(http.MethodDelete, "/api/v1/regular_expenses/7", ownerID, map[string]string{"regular_expense_id": "7"}, "")
+	w := httptest.NewRecorder()
+	s.APIDeleteRegularExpense(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
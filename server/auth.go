@@ -2,15 +2,18 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/sergeykhargelia/vct-project/model"
 	"github.com/sergeykhargelia/vct-project/templates"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 var jwtSecret = []byte(os.Getenv("jwt"))
@@ -26,28 +29,51 @@ func (s *Server) LoginPage(w http.ResponseWriter, r *http.Request) {
 func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	name := r.PostFormValue("name")
-	email := r.PostFormValue("email")
-	password := r.PostFormValue("password")
+	_, err := s.registerUser(r.PostFormValue("name"), r.PostFormValue("email"), r.PostFormValue("password"))
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
 
+	s.LoginHandler(w, r)
+}
+
+// registerUser creates a user with the default categories.
+func (s *Server) registerUser(name, email, password string) (model.User, error) {
+	name = strings.TrimSpace(name)
+	email = strings.TrimSpace(email)
+
+	var user model.User
 	if len(name) == 0 || len(email) == 0 || len(password) == 0 {
-		templates.ErrorMessage("Fields should be non-empty").Render(r.Context(), w)
-		return
+		return user, invalidInput(errors.New("Fields should be non-empty"))
+	}
+
+	var existing int64
+	if err := s.DB.Model(&model.User{}).Where("email = ?", email).Count(&existing).Error; err != nil {
+		return user, failure("Error while creating user", err)
+	}
+	if existing > 0 {
+		return user, conflict("User with this email already exists")
 	}
 
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		templates.ErrorMessage("Failed to hash password").Render(r.Context(), w)
-		return
+		return user, failure("Failed to hash password", err)
 	}
 
-	user := model.User{Email: email, Name: name, PasswordHash: string(passwordHash)}
-	if err := s.DB.Create(&user).Error; err != nil {
-		templates.ErrorMessage("Error while creating user").Render(r.Context(), w)
-		return
+	user = model.User{Email: email, Name: name, PasswordHash: string(passwordHash)}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		categories := defaultCategories(user.ID)
+		return tx.Create(&categories).Error
+	})
+	if err != nil {
+		return user, failure("Error while creating user", err)
 	}
 
-	s.LoginHandler(w, r)
+	return user, nil
 }
 
 type Claims struct {
@@ -55,75 +81,138 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+// tokenLifetime is how long a session token stays valid.
+const tokenLifetime = time.Hour
+
 func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	email := r.PostFormValue("email")
-	password := r.PostFormValue("password")
+	user, err := s.authenticate(r.PostFormValue("email"), r.PostFormValue("password"))
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
 
-	var user model.User
-	if s.DB.Where("email = ?", email).First(&user).Error != nil {
-		templates.ErrorMessage("User does not exist").Render(r.Context(), w)
+	tokenString, _, err := issueToken(user.ID)
+	if err != nil {
+		renderServiceError(w, r, err)
 		return
 	}
 
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    tokenString,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticate finds the user with email and checks their password.
+func (s *Server) authenticate(email, password string) (model.User, error) {
+	var user model.User
+	err := s.DB.Where("email = ?", strings.TrimSpace(email)).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, unauthorized("User does not exist")
+	}
+	if err != nil {
+		return user, failure("Failed to find user", err)
+	}
+
 	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
-		templates.ErrorMessage("Wrong password").Render(r.Context(), w)
-		return
+		return user, unauthorized("Wrong password")
 	}
 
+	return user, nil
+}
+
+// issueToken signs a session token of the user, which is accepted by
+// AuthMiddleware in the cookie and by APIAuthMiddleware in the
+// Authorization header. It returns the token and when it expires.
+func issueToken(userID uint64) (string, time.Time, error) {
+	expiresAt := time.Now().Add(tokenLifetime)
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
-		UserID: user.ID,
+		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
 	})
 
 	tokenString, err := token.SignedString(jwtSecret)
 	if err != nil {
-		templates.ErrorMessage("Failed to sign token").Render(r.Context(), w)
-		return
+		return "", time.Time{}, failure("Failed to sign token", err)
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    tokenString,
-		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
+	return tokenString, expiresAt, nil
+}
+
+// parseToken returns the id of the user a valid, unexpired session token
+// was issued to.
+func parseToken(tokenStr string) (uint64, error) {
+	var claims Claims
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (any, error) {
+		if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, fmt.Errorf("Signing algorithm mismatch")
+		}
+		return jwtSecret, nil
 	})
 
-	w.Header().Set("HX-Redirect", "/")
-	w.WriteHeader(http.StatusOK)
+	if err != nil {
+		return 0, err
+	}
+	if !token.Valid || claims.ExpiresAt == nil || claims.ExpiresAt.Time.Before(time.Now()) {
+		return 0, errors.New("token has expired")
+	}
+
+	return claims.UserID, nil
 }
 
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie("token")
 		if err != nil {
-			templates.ErrorMessage("Error while reading cookie")
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
 		}
 
-		if cookie == nil {
+		userID, err := parseToken(cookie.Value)
+		if err != nil {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
 
-		tokenStr := cookie.Value
+		ctx := context.WithValue(r.Context(), "user_id", userID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
 
-		var claims Claims
-		token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (any, error) {
-			if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
-				return nil, fmt.Errorf("Signing algorithm mismatch")
+// APIAuthMiddleware authenticates requests to the JSON API by the session
+// token in the Authorization header, falling back to the session cookie so
+// that the API can be used from the browser as well. Unauthenticated
+// requests are rejected with 401 instead of being sent to the login page.
+func APIAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenStr, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			if cookie, err := r.Cookie("token"); err == nil {
+				tokenStr = cookie.Value
 			}
-			return jwtSecret, nil
-		})
+		}
 
-		if err != nil || !token.Valid || claims.ExpiresAt.Time.Before(time.Now()) {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		if tokenStr == "" {
+			writeAPIError(w, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+			return
+		}
+
+		userID, err := parseToken(strings.TrimSpace(tokenStr))
+		if err != nil {
+			writeAPIError(w, http.StatusUnauthorized, codeUnauthenticated, "Invalid or expired token")
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+		ctx := context.WithValue(r.Context(), "user_id", userID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
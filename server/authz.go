@@ -0,0 +1,87 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sergeykhargelia/vct-project/templates"
+	"gorm.io/gorm"
+)
+
+var (
+	errUnauthenticated = errors.New("user id is missing from request context")
+	errInvalidID       = errors.New("invalid resource id")
+	errNotFound        = errors.New("resource not found")
+)
+
+// resource describes a user-owned table row addressed by a route variable.
+type resource struct {
+	name  string
+	idVar string
+}
+
+var (
+	regularExpenseResource = resource{name: "regular expense", idVar: "regular_expense_id"}
+	expenseResource        = resource{name: "expense", idVar: "expense_id"}
+	categoryResource       = resource{name: "category", idVar: "category_id"}
+	budgetResource         = resource{name: "budget", idVar: "budget_id"}
+)
+
+func userIDFromContext(r *http.Request) (uint64, bool) {
+	userID, ok := r.Context().Value("user_id").(uint64)
+	return userID, ok
+}
+
+// findOwned loads the row of res addressed by the request into dst, provided
+// it belongs to the authenticated user and matches every extra condition.
+// A row owned by someone else is reported as errNotFound, exactly like a
+// missing one, so that ids of other users' data cannot be probed.
+func (s *Server) findOwned(r *http.Request, res resource, dst any, conds ...string) error {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		return errUnauthenticated
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)[res.idVar], 10, 64)
+	if err != nil {
+		return errInvalidID
+	}
+
+	query := s.DB.Where("id = ? AND user_id = ?", id, userID)
+	for _, cond := range conds {
+		query = query.Where(cond)
+	}
+
+	err = query.First(dst).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errNotFound
+	}
+
+	return err
+}
+
+// renderLookupError reports an error returned by findOwned.
+func renderLookupError(w http.ResponseWriter, r *http.Request, res resource, err error) {
+	title := strings.ToUpper(res.name[:1]) + res.name[1:]
+	// templates.SwapErrorResponses shows only HTML error fragments.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		w.WriteHeader(http.StatusUnauthorized)
+		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
+	case errors.Is(err, errInvalidID):
+		w.WriteHeader(http.StatusBadRequest)
+		templates.ErrorMessage("Invalid "+res.name+" id").Render(r.Context(), w)
+	case errors.Is(err, errNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		templates.ErrorMessage(title+" not found").Render(r.Context(), w)
+	default:
+		logFailure("Failed to find "+res.name, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		templates.ErrorMessage("Failed to find "+res.name).Render(r.Context(), w)
+	}
+}
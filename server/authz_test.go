@@ -0,0 +1,124 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	ownerID    = uint64(1)
+	intruderID = uint64(2)
+)
+
+func newAuthenticatedRequest(method, target string, userID uint64, vars map[string]string, form url.Values) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = mux.SetURLVars(req, vars)
+	return req.WithContext(context.WithValue(req.Context(), "user_id", userID))
+}
+
+func TestForeignResourcesAreNotFound(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	regularExpenseVars := map[string]string{"regular_expense_id": "7"}
+	expenseVars := map[string]string{"expense_id": "7"}
+	categoryVars := map[string]string{"category_id": "7"}
+	budgetVars := map[string]string{"budget_id": "7"}
+	form := url.Values{"name": {"hijacked"}, "amount": {"1"}}
+
+	table := []struct {
+		name   string
+		method string
+		target string
+		vars   map[string]string
+		table  string
+		f      http.HandlerFunc
+	}{
+		{"delete regular expense", http.MethodDelete, "/regular_expenses/7", regularExpenseVars, "regular_expenses", s.DeleteRegularExpense},
+		{"update regular expense", http.MethodPatch, "/regular_expenses/7", regularExpenseVars, "regular_expenses", s.UpdateRegularExpense},
+		{"edit regular expense form", http.MethodGet, "/regular_expenses/7/edit", regularExpenseVars, "regular_expenses", s.EditRegularExpenseForm},
+		{"pause regular expense", http.MethodPost, "/regular_expenses/7/pause", regularExpenseVars, "regular_expenses", s.PauseRegularExpense},
+		{"resume regular expense", http.MethodPost, "/regular_expenses/7/resume", regularExpenseVars, "regular_expenses", s.ResumeRegularExpense},
+		{"restore regular expense", http.MethodPost, "/regular_expenses/7/restore", regularExpenseVars, "regular_expenses", s.RestoreRegularExpense},
+		{"update expense", http.MethodPatch, "/expenses/7", expenseVars, "expenses", s.UpdateExpense},
+		{"delete expense", http.MethodDelete, "/expenses/7", expenseVars, "expenses", s.DeleteExpense},
+		{"delete category", http.MethodDelete, "/categories/7", categoryVars, "categories", s.DeleteCategory},
+		{"update budget", http.MethodPatch, "/budgets/7", budgetVars, "budgets", s.UpdateBudget},
+		{"delete budget", http.MethodDelete, "/budgets/7", budgetVars, "budgets", s.DeleteBudget},
+		{"api get regular expense", http.MethodGet, "/api/v1/regular_expenses/7", regularExpenseVars, "regular_expenses", s.APIGetRegularExpense},
+		{"api update regular expense", http.MethodPatch, "/api/v1/regular_expenses/7", regularExpenseVars, "regular_expenses", s.APIUpdateRegularExpense},
+		{"api delete regular expense", http.MethodDelete, "/api/v1/regular_expenses/7", regularExpenseVars, "regular_expenses", s.APIDeleteRegularExpense},
+		{"api get expense", http.MethodGet, "/api/v1/expenses/7", expenseVars, "expenses", s.APIGetExpense},
+		{"api update expense", http.MethodPatch, "/api/v1/expenses/7", expenseVars, "expenses", s.APIUpdateExpense},
+		{"api delete expense", http.MethodDelete, "/api/v1/expenses/7", expenseVars, "expenses", s.APIDeleteExpense},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			mock.ExpectQuery(`SELECT \* FROM "`+params.table+`" WHERE \(?id = \$1 AND user_id = \$2`).
+				WithArgs(uint64(7), intruderID, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}))
+
+			req := newAuthenticatedRequest(params.method, params.target, intruderID, params.vars, form)
+			w := httptest.NewRecorder()
+			params.f(w, req)
+
+			assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOwnerCanDeleteRegularExpense(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(id = \$1 AND user_id = \$2\)`).
+		WithArgs(uint64(7), ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "next_date"}).AddRow(7, ownerID, "2026-01-01"))
+	mock.ExpectExec(`UPDATE "regular_expenses" SET "cancelled_at"=\$1,"status"=\$2 WHERE "id" = \$3`).
+		WithArgs(sqlmock.AnyArg(), "cancelled", uint64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := newAuthenticatedRequest(http.MethodDelete, "/regular_expenses/7", ownerID, map[string]string{"regular_expense_id": "7"}, nil)
+	w := httptest.NewRecorder()
+	s.DeleteRegularExpense(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnauthenticatedRequestIsRejected(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	req := httptest.NewRequest(http.MethodDelete, "/regular_expenses/7", nil)
+	req = mux.SetURLVars(req, map[string]string{"regular_expense_id": "7"})
+	w := httptest.NewRecorder()
+	s.DeleteRegularExpense(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForeignCategoryIsRejected(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "categories" WHERE id = \$1 AND user_id = \$2`).
+		WithArgs(uint64(3), ownerID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	form := url.Values{"name": {"Headphones"}, "amount": {"100"}, "currency": {"RUB"}, "date": {"2026-01-01"}, "category": {"3"}}
+	req := newAuthenticatedRequest(http.MethodPost, "/expenses", ownerID, nil, form)
+	w := httptest.NewRecorder()
+	s.CreateExpense(w, req)
+
+	assert.Contains(t, w.Body.String(), "Category not found")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
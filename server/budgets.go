@@ -0,0 +1,402 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/templates"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// budgetMonth returns the first and the last day of the calendar month
+// holding date.
+func budgetMonth(date time.Time) (start, end string) {
+	first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return first.Format(time.DateOnly), first.AddDate(0, 1, -1).Format(time.DateOnly)
+}
+
+// budgetStatus computes how budget stands in the month holding date. Recorded
+// spending is converted at the rate known on each expense date, upcoming
+// payments at the latest known rate.
+func (s *Server) budgetStatus(budget model.Budget, date time.Time) (templates.BudgetStatus, error) {
+	start, end := budgetMonth(date)
+	currency := budget.Amount.Currency
+
+	status := templates.BudgetStatus{
+		ID:         budget.ID,
+		CategoryID: budget.CategoryID,
+		Amount:     budget.Amount,
+		Thresholds: budget.Thresholds,
+		Month:      start[:len("2006-01")],
+		Recorded:   model.Money{Currency: currency},
+		Forecast:   model.Money{Currency: currency},
+	}
+	if budget.Category != nil {
+		status.CategoryName = budget.Category.Name
+	}
+
+	var recorded templates.Summary
+	err := s.DB.Raw(
+		`SELECT COALESCE(ROUND(SUM(converted)), 0) AS total,
+			COUNT(*) FILTER (WHERE converted IS NULL) AS unconverted
+		FROM (
+			SELECT `+convertedAmountSQL+` AS converted
+			FROM expenses e
+			WHERE e.user_id = @user AND e.date >= @start AND e.date <= @end
+				AND (CAST(@category AS bigint) IS NULL OR e.category_id = @category)
+		) AS converted_expenses`,
+		map[string]any{
+			"base":     currency,
+			"user":     budget.UserID,
+			"start":    start,
+			"end":      end,
+			"category": budget.CategoryID,
+		},
+	).Scan(&recorded).Error
+	if err != nil {
+		return status, err
+	}
+	status.Recorded.Minor = recorded.Total
+	status.Unconverted = recorded.Unconverted
+
+	query := s.DB.Preload("AmountChanges", func(db *gorm.DB) *gorm.DB {
+		return db.Order("effective_date asc")
+	}).Where("user_id = ? AND status = ? AND next_date <= ?", budget.UserID, model.RegularExpenseActive, end)
+	if budget.CategoryID != nil {
+		query = query.Where("category_id = ?", *budget.CategoryID)
+	}
+
+	var regularExpenses []model.RegularExpense
+	if err := query.Find(&regularExpenses).Error; err != nil {
+		return status, err
+	}
+
+	var upcoming []model.Occurrence
+	var currencies []string
+	for _, e := range regularExpenses {
+		occurrences, err := e.Forecast(end)
+		if err != nil {
+			return status, fmt.Errorf("failed to expand schedule of regular expense %d: %w", e.ID, err)
+		}
+
+		for _, occurrence := range occurrences {
+			// Payments overdue from earlier months are not this month's spending.
+			if occurrence.Date >= start {
+				upcoming = append(upcoming, occurrence)
+			}
+		}
+		currencies = append(currencies, e.Amount.Currency)
+	}
+
+	rates, err := s.latestRates(currency, currencies)
+	if err != nil {
+		return status, err
+	}
+
+	for _, occurrence := range upcoming {
+		rate, ok := rates[occurrence.Amount.Currency]
+		if !ok {
+			status.Unconverted++
+			continue
+		}
+		status.Forecast.Minor += occurrence.Amount.Convert(rate, currency).Minor
+	}
+
+	return status, nil
+}
+
+// crossedThreshold returns the highest threshold of budget that its projected
+// spending has reached.
+func crossedThreshold(budget model.Budget, status templates.BudgetStatus) (int, bool) {
+	percent := status.Percent()
+	threshold, ok := 0, false
+	for _, t := range budget.EffectiveThresholds() {
+		if percent >= float64(t) {
+			threshold, ok = t, true
+		}
+	}
+	return threshold, ok
+}
+
+func budgetAlertText(user model.User, status templates.BudgetStatus, threshold int) string {
+	budget := "overall budget"
+	if status.CategoryID != nil {
+		budget = status.CategoryName + " budget"
+	}
+
+	text := fmt.Sprintf(
+		"Dear %s! Your spending for %s, including upcoming regular payments, is heading for %s, %.0f%% of your %s of %s.\n",
+		user.Name,
+		status.Month,
+		status.Projected(),
+		status.Percent(),
+		budget,
+		status.Amount,
+	)
+
+	if threshold >= 100 {
+		text += "This is over the budget.\n"
+	}
+
+	return text
+}
+
+// CheckBudgets alerts the owners of budgets whose recorded plus forecast
+// spending for the month holding date has reached one of their thresholds.
+// Only the highest threshold reached is reported, and each threshold at most
+// once per budget and month. It is meant to run after DoRegularPayments, so
+// that payments due on date are already recorded.
+func (s *Server) CheckBudgets(date string) error {
+	today, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return err
+	}
+
+	var budgets []model.Budget
+	if err := s.DB.Preload("User").Preload("Category").Find(&budgets).Error; err != nil {
+		return err
+	}
+
+	type alert struct {
+		budget    model.Budget
+		status    templates.BudgetStatus
+		threshold int
+	}
+
+	var alerts []alert
+	for _, budget := range budgets {
+		status, err := s.budgetStatus(budget, today)
+		if err != nil {
+			return err
+		}
+
+		if threshold, ok := crossedThreshold(budget, status); ok {
+			alerts = append(alerts, alert{budget, status, threshold})
+		}
+	}
+
+	now := time.Now()
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, a := range alerts {
+			msg := Message{
+				Subject: "Budget alert",
+				Body:    budgetAlertText(a.budget.User, a.status, a.threshold),
+			}
+
+			dedupKey := fmt.Sprintf("budget:%d:%s:%d", a.budget.ID, a.status.Month, a.threshold)
+			if err := enqueue(tx, a.budget.User, dedupKey, msg, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// normalizeBudgetThresholds validates a comma-separated list of thresholds
+// from a form and returns it in canonical form.
+func normalizeBudgetThresholds(value string) (string, error) {
+	thresholds, err := model.ParseBudgetThresholds(value)
+	if err != nil {
+		return "", fmt.Errorf("Thresholds should be comma-separated percentages from 1 to %d", model.MaxBudgetThreshold)
+	}
+
+	if len(thresholds) == 0 {
+		return model.DefaultBudgetThresholds, nil
+	}
+
+	parts := make([]string, len(thresholds))
+	for i, threshold := range thresholds {
+		parts[i] = strconv.Itoa(threshold)
+	}
+
+	return strings.Join(parts, ","), nil
+}
+
+// budgetFields reads the columns of a budget from a form. When required is
+// false only the submitted fields are returned, for a partial update.
+func budgetFields(r *http.Request, required bool, currentCurrency string) (map[string]any, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, errors.New("Failed to parse form")
+	}
+
+	fields := map[string]any{}
+
+	currency := currentCurrency
+	if required || r.PostForm.Has("currency") {
+		parsed, err := parseCurrency(r.PostForm.Get("currency"))
+		if err != nil {
+			return nil, err
+		}
+		currency = parsed
+		fields["currency"] = currency
+	}
+	// The stored amount is in minor units of the current currency.
+	if !required && currency != currentCurrency && !r.PostForm.Has("amount") {
+		return nil, errors.New("Amount is required when changing the currency")
+	}
+
+	if required || r.PostForm.Has("amount") {
+		amount, err := model.ParseMoney(r.PostForm.Get("amount"), currency)
+		if err != nil {
+			return nil, errors.New("Failed to parse amount")
+		}
+		if amount.Minor == 0 {
+			return nil, errors.New("Budget should be greater than zero")
+		}
+		fields["amount"] = amount.Minor
+	}
+
+	if required || r.PostForm.Has("thresholds") {
+		thresholds, err := normalizeBudgetThresholds(r.PostForm.Get("thresholds"))
+		if err != nil {
+			return nil, err
+		}
+		fields["thresholds"] = thresholds
+	}
+
+	if len(fields) == 0 {
+		return nil, errors.New("Nothing to update")
+	}
+
+	return fields, nil
+}
+
+// Budgets lists the user's budgets with their recorded and forecast spending
+// for the current month. The result is JSON, or an HTML fragment for HTMX
+// requests.
+func (s *Server) Budgets(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "Failed to parse user id from request context", http.StatusUnauthorized)
+		return
+	}
+
+	var budgets []model.Budget
+	err := s.DB.Preload("Category").Where("user_id = ?", userID).Order("category_id NULLS FIRST, id").Find(&budgets).Error
+	if err != nil {
+		logFailure("Error while finding budgets", err)
+		http.Error(w, "Error while finding budgets", http.StatusInternalServerError)
+		return
+	}
+
+	statuses := make([]templates.BudgetStatus, len(budgets))
+	for i, budget := range budgets {
+		statuses[i], err = s.budgetStatus(budget, time.Now())
+		if err != nil {
+			logFailure("Error while computing budget spending", err)
+			http.Error(w, "Error while computing budget spending", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		categories, err := s.userCategories(userID)
+		if err != nil {
+			renderServiceError(w, r, failure("Error while finding categories", err))
+			return
+		}
+
+		templates.BudgetsPanel(statuses, categories).Render(r.Context(), w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// CreateBudget adds an overall budget, or a budget for one category. A user
+// has at most one budget of each kind.
+func (s *Server) CreateBudget(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
+		return
+	}
+
+	fields, err := budgetFields(r, true, "")
+	if err != nil {
+		templates.ErrorMessage(err.Error()).Render(r.Context(), w)
+		return
+	}
+
+	categoryID, err := parseCategoryID(r.PostForm.Get("category"))
+	if err != nil {
+		templates.ErrorMessage(err.Error()).Render(r.Context(), w)
+		return
+	}
+	if err := s.checkCategory(userID, categoryID); err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+
+	budget := model.Budget{
+		UserID:     userID,
+		CategoryID: categoryID,
+		Amount:     model.Money{Minor: fields["amount"].(int64), Currency: fields["currency"].(string)},
+		Thresholds: fields["thresholds"].(string),
+	}
+	// The unique indexes on budgets keep concurrent requests from creating
+	// the same budget twice, the second insert does nothing.
+	result := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&budget)
+	if result.Error != nil {
+		renderServiceError(w, r, failure("Failed to create budget", result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		templates.ErrorMessage("Budget already exists").Render(r.Context(), w)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) UpdateBudget(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var budget model.Budget
+	if err := s.findOwned(r, budgetResource, &budget); err != nil {
+		renderLookupError(w, r, budgetResource, err)
+		return
+	}
+
+	fields, err := budgetFields(r, false, budget.Amount.Currency)
+	if err != nil {
+		templates.ErrorMessage(err.Error()).Render(r.Context(), w)
+		return
+	}
+
+	if err := s.DB.Model(&budget).Updates(fields).Error; err != nil {
+		renderServiceError(w, r, failure("Failed to update budget", err))
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	var budget model.Budget
+	if err := s.findOwned(r, budgetResource, &budget); err != nil {
+		renderLookupError(w, r, budgetResource, err)
+		return
+	}
+
+	if err := s.DB.Delete(&budget).Error; err != nil {
+		renderServiceError(w, r, failure("Failed to delete budget", err))
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
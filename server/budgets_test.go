@@ -0,0 +1,111 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckBudgetsAlertsHighestThresholdReached(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "budgets"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "category_id", "amount", "currency", "thresholds"}).
+			AddRow(1, 1, nil, 100000, "RUB", "50,80,100"))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "notification_channels"}).
+			AddRow(1, "first@example.com", "First", "email"))
+	mock.ExpectQuery(`(?s)SELECT COALESCE\(ROUND\(SUM\(converted\)\), 0\) AS total,.*FROM expenses e.*e.category_id = \$\d+`).
+		WithArgs("RUB", "RUB", "RUB", "RUB", uint64(1), "2026-03-01", "2026-03-31", nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "unconverted"}).AddRow(70000, 0))
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE user_id = \$1 AND status = \$2 AND next_date <= \$3`).
+		WithArgs(uint64(1), "active", "2026-03-31").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "amount", "currency", "status", "next_date", "start_date", "recurrence"}).
+			AddRow(2, 1, "Internet", 15000, "RUB", "active", "2026-03-20", "2026-01-20", "FREQ=MONTHLY"))
+	mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE "amount_changes"."regular_expense_id" = \$1 ORDER BY effective_date asc`).
+		WithArgs(uint64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "regular_expense_id", "amount", "effective_date"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "notifications" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), "email", "budget:1:2026-03:80:email", "Budget alert",
+			"Dear First! Your spending for 2026-03, including upcoming regular payments, is heading for 850.00 RUB, 85% of your overall budget of 1000.00 RUB.\n",
+			"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, s.CheckBudgets("2026-03-10"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckBudgetsSkipsBudgetsBelowThresholds(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "budgets"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "category_id", "amount", "currency", "thresholds"}).
+			AddRow(1, 1, 3, 100000, "RUB", ""))
+	mock.ExpectQuery(`SELECT \* FROM "categories" WHERE "categories"."id" = \$1`).
+		WithArgs(uint64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name"}).AddRow(3, 1, "Streaming"))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "notification_channels"}).
+			AddRow(1, "first@example.com", "First", "email"))
+	mock.ExpectQuery(`(?s)SELECT COALESCE\(ROUND\(SUM\(converted\)\), 0\) AS total,.*FROM expenses e`).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "unconverted"}).AddRow(79000, 0))
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(user_id = \$1 AND status = \$2 AND next_date <= \$3\) AND category_id = \$4`).
+		WithArgs(uint64(1), "active", "2026-03-31", uint64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	assert.NoError(t, s.CheckBudgets("2026-03-10"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateBudget(t *testing.T) {
+	table := []struct {
+		name    string
+		created bool
+	}{
+		{"created", true},
+		// The insert hits the unique index when another request has created
+		// the same budget in the meantime.
+		{"already exists", false},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			s, mock := initTestServer(t)
+
+			mock.ExpectQuery(`SELECT count\(\*\) FROM "categories" WHERE id = \$1 AND user_id = \$2`).
+				WithArgs(uint64(3), ownerID).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			rows := sqlmock.NewRows([]string{"id"})
+			if params.created {
+				rows.AddRow(1)
+			}
+			mock.ExpectQuery(`INSERT INTO "budgets" \("user_id","category_id","amount","currency","thresholds"\) VALUES \(\$1,\$2,\$3,\$4,\$5\) ON CONFLICT DO NOTHING RETURNING "id"`).
+				WithArgs(ownerID, uint64(3), int64(1500000), "RUB", "80,100").
+				WillReturnRows(rows)
+
+			form := url.Values{"category": {"3"}, "amount": {"15000"}, "currency": {"RUB"}, "thresholds": {"80, 100"}}
+			req := newAuthenticatedRequest(http.MethodPost, "/budgets", ownerID, nil, form)
+			w := httptest.NewRecorder()
+			s.CreateBudget(w, req)
+
+			if params.created {
+				assert.Equal(t, "/", w.Header().Get("HX-Redirect"))
+			} else {
+				assert.Contains(t, w.Body.String(), "Budget already exists")
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
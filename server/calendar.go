@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/templates"
+	"gorm.io/gorm"
+)
+
+// calendarTokenBytes is how many random bytes calendar feed tokens have.
+const calendarTokenBytes = 32
+
+func newCalendarToken() (string, error) {
+	b := make([]byte, calendarTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// calendarFeedURL returns the address of the calendar feed with token. It is
+// built from the configured base URL rather than from the Host and
+// X-Forwarded-Proto headers, which the client controls.
+func (s *Server) calendarFeedURL(token string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/calendar/" + token + ".ics"
+}
+
+// CreateCalendarToken gives the user a new calendar feed URL. An existing
+// feed URL stops working.
+func (s *Server) CreateCalendarToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
+		return
+	}
+
+	token, err := newCalendarToken()
+	if err != nil {
+		renderServiceError(w, r, failure("Failed to create calendar link", err))
+		return
+	}
+
+	if err := s.DB.Model(&model.User{ID: userID}).Update("calendar_token", token).Error; err != nil {
+		renderServiceError(w, r, failure("Failed to create calendar link", err))
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/settings")
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteCalendarToken revokes the user's calendar feed URL.
+func (s *Server) DeleteCalendarToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
+		return
+	}
+
+	if err := s.DB.Model(&model.User{ID: userID}).Update("calendar_token", nil).Error; err != nil {
+		renderServiceError(w, r, failure("Failed to revoke calendar link", err))
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/settings")
+	w.WriteHeader(http.StatusOK)
+}
+
+// CalendarFeed serves the upcoming payments of the owner of the token in the
+// URL as an iCalendar feed for calendar applications to subscribe to. The
+// token stands in for the session cookie, which calendar applications do not
+// have. The feed is built on every request, so edits, pauses and
+// cancellations show up the next time it is polled.
+func (s *Server) CalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	if token == "" {
+		http.Error(w, "Calendar not found", http.StatusNotFound)
+		return
+	}
+
+	var user model.User
+	err := s.DB.Where("calendar_token = ?", token).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Calendar not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logFailure("Failed to find calendar", err)
+		http.Error(w, "Failed to find calendar", http.StatusInternalServerError)
+		return
+	}
+
+	until := time.Now().AddDate(0, 0, defaultCalendarDays).Format(time.DateOnly)
+	calendar, err := s.regularPaymentsCalendar(user, until)
+	if err != nil {
+		logFailure("Error while building calendar", err)
+		http.Error(w, "Error while building calendar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := calendar.Write(w, time.Now()); err != nil {
+		logFailure("Failed to write calendar", err)
+	}
+}
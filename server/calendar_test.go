@@ -0,0 +1,112 @@
+package server_test
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarFeedNeedsNoCookie(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE calendar_token = \$1`).
+		WithArgs("secret", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "calendar_token"}).AddRow(ownerID, "First", "secret"))
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE user_id = \$1 AND status = \$2 AND next_date <= \$3 ORDER BY id`).
+		WithArgs(ownerID, "active", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/calendar/secret.ics", nil)
+	req = mux.SetURLVars(req, map[string]string{"token": "secret"})
+	w := httptest.NewRecorder()
+	s.CalendarFeed(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(w.Body.String(), "BEGIN:VCALENDAR\r\n"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokedCalendarTokenIsNotFound(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE calendar_token = \$1`).
+		WithArgs("revoked", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/calendar/revoked.ics", nil)
+	req = mux.SetURLVars(req, map[string]string{"token": "revoked"})
+	w := httptest.NewRecorder()
+	s.CalendarFeed(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateCalendarTokenReplacesToken(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectExec(`UPDATE "users" SET "calendar_token"=\$1 WHERE "id" = \$2`).
+		WithArgs(sqlmock.AnyArg(), ownerID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := newAuthenticatedRequest(http.MethodPost, "/settings/calendar_token", ownerID, nil, nil)
+	w := httptest.NewRecorder()
+	s.CreateCalendarToken(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "/settings", w.Header().Get("HX-Redirect"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateCalendarTokenLogsFailure(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	mock.ExpectExec(`UPDATE "users" SET "calendar_token"=\$1 WHERE "id" = \$2`).
+		WithArgs(sqlmock.AnyArg(), ownerID).
+		WillReturnError(errors.New("pq: deadlock detected"))
+
+	req := newAuthenticatedRequest(http.MethodPost, "/settings/calendar_token", ownerID, nil, nil)
+	w := httptest.NewRecorder()
+	s.CreateCalendarToken(w, req)
+
+	assert.Contains(t, w.Body.String(), "Failed to create calendar link")
+	assert.NotContains(t, w.Body.String(), "deadlock")
+	assert.Contains(t, logged.String(), "Failed to create calendar link: pq: deadlock detected")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCalendarFeedURLIgnoresRequestHost(t *testing.T) {
+	s, mock := initTestServer(t)
+	s.BaseURL = "https://vct.example.com/"
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "calendar_token"}).AddRow(ownerID, "First", "secret"))
+	mock.ExpectQuery(`SELECT \* FROM "categories" WHERE user_id = \$1 ORDER BY name`).
+		WithArgs(ownerID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name"}))
+
+	req := newAuthenticatedRequest(http.MethodGet, "/settings", ownerID, nil, nil)
+	req.Host = "attacker.example"
+	req.Header.Set("X-Forwarded-Proto", "http")
+	w := httptest.NewRecorder()
+	s.SettingsPage(w, req)
+
+	assert.Contains(t, w.Body.String(), "https://vct.example.com/calendar/secret.ics")
+	assert.NotContains(t, w.Body.String(), "attacker.example")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
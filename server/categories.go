@@ -0,0 +1,149 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/templates"
+	"gorm.io/gorm"
+)
+
+func defaultCategories(userID uint64) []model.Category {
+	categories := make([]model.Category, len(model.DefaultCategories))
+	for i, name := range model.DefaultCategories {
+		categories[i] = model.Category{UserID: userID, Name: name}
+	}
+	return categories
+}
+
+func (s *Server) userCategories(userID uint64) ([]model.Category, error) {
+	var categories []model.Category
+	err := s.DB.Where("user_id = ?", userID).Order("name").Find(&categories).Error
+	return categories, err
+}
+
+// parseCategoryID parses the id of a category picked in a form. It returns
+// nil when value is empty, which leaves the expense without a category.
+func parseCategoryID(value string) (*uint64, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, errors.New("Invalid category")
+	}
+	return &id, nil
+}
+
+// checkCategory makes sure that the category an expense is being assigned to,
+// if any, belongs to the user.
+func (s *Server) checkCategory(userID uint64, categoryID *uint64) error {
+	if categoryID == nil {
+		return nil
+	}
+
+	var count int64
+	err := s.DB.Model(&model.Category{}).Where("id = ? AND user_id = ?", *categoryID, userID).Count(&count).Error
+	if err != nil {
+		return failure("Failed to find category", err)
+	}
+	if count == 0 {
+		return invalidInput(errors.New("Category not found"))
+	}
+	return nil
+}
+
+// checkCategoryField runs checkCategory on the category_id column of an
+// update, if the update sets it.
+func (s *Server) checkCategoryField(userID uint64, fields map[string]any) error {
+	categoryID, ok := fields["category_id"].(*uint64)
+	if !ok {
+		return nil
+	}
+	return s.checkCategory(userID, categoryID)
+}
+
+// parseTags normalizes the tags submitted in a form, see model.ParseTags.
+func parseTags(value string) (string, error) {
+	tags, err := model.ParseTags(value)
+	if err != nil {
+		return "", errors.New("Invalid tags: " + err.Error())
+	}
+	return tags, nil
+}
+
+// filterByCategoryAndTag narrows a query on regular_expenses or expenses down
+// to the category and the tag given in the query string, if any.
+func filterByCategoryAndTag(query *gorm.DB, r *http.Request) (*gorm.DB, error) {
+	if value := r.URL.Query().Get("category"); value != "" {
+		categoryID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("Invalid category")
+		}
+		query = query.Where("category_id = ?", categoryID)
+	}
+
+	if value := r.URL.Query().Get("tag"); value != "" {
+		query = query.Where("? = ANY(string_to_array(tags, ','))", strings.ToLower(strings.TrimSpace(value)))
+	}
+
+	return query, nil
+}
+
+func (s *Server) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
+		return
+	}
+
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	if name == "" || utf8.RuneCountInString(name) > 50 {
+		templates.ErrorMessage("Category name should be non-empty and at most 50 characters long").Render(r.Context(), w)
+		return
+	}
+
+	var existing int64
+	err := s.DB.Model(&model.Category{}).Where("user_id = ? AND name = ?", userID, name).Count(&existing).Error
+	if err != nil {
+		renderServiceError(w, r, failure("Failed to create category", err))
+		return
+	}
+	if existing > 0 {
+		templates.ErrorMessage("Category already exists").Render(r.Context(), w)
+		return
+	}
+
+	if err := s.DB.Create(&model.Category{UserID: userID, Name: name}).Error; err != nil {
+		renderServiceError(w, r, failure("Failed to create category", err))
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/settings")
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteCategory removes a category. Expenses in it are kept without a
+// category.
+func (s *Server) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	var category model.Category
+	if err := s.findOwned(r, categoryResource, &category); err != nil {
+		renderLookupError(w, r, categoryResource, err)
+		return
+	}
+
+	if err := s.DB.Delete(&category).Error; err != nil {
+		renderServiceError(w, r, failure("Failed to delete category", err))
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/settings")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/sergeykhargelia/vct-project/templates"
+)
+
+// errorKind tells what went wrong in a service function, so that the JSON
+// API can respond with a fitting status. The HTMX handlers only show the
+// message.
+type errorKind int
+
+const (
+	kindInternal errorKind = iota
+	kindInvalid
+	kindConflict
+	kindUnauthorized
+)
+
+// serviceError is an error returned by the service functions shared by the
+// HTMX handlers and the JSON API. Its message can be shown to the user as is.
+type serviceError struct {
+	kind    errorKind
+	message string
+	err     error
+}
+
+func (e *serviceError) Error() string {
+	return e.message
+}
+
+func (e *serviceError) Unwrap() error {
+	return e.err
+}
+
+// invalidInput reports a problem with the submitted data, described by err.
+func invalidInput(err error) error {
+	return &serviceError{kind: kindInvalid, message: err.Error(), err: err}
+}
+
+func conflict(message string) error {
+	return &serviceError{kind: kindConflict, message: message}
+}
+
+func unauthorized(message string) error {
+	return &serviceError{kind: kindUnauthorized, message: message}
+}
+
+// failure reports that the service failed with err, showing message instead
+// of the underlying error.
+func failure(message string, err error) error {
+	return &serviceError{kind: kindInternal, message: message, err: err}
+}
+
+// errorKindOf returns the kind of a service error, kindInternal for errors
+// that are not one.
+func errorKindOf(err error) errorKind {
+	var serviceErr *serviceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.kind
+	}
+	return kindInternal
+}
+
+// logFailure records why a request failed, next to the message the user was
+// shown instead of err.
+func logFailure(message string, err error) {
+	log.Printf("%s: %v", message, err)
+}
+
+// publicMessage returns the message of err that can be shown to the user.
+// Internal errors are logged with their cause first, and errors that are not
+// service errors are only reported as "Internal error".
+func publicMessage(err error) string {
+	if errorKindOf(err) != kindInternal {
+		return err.Error()
+	}
+
+	message, cause := "Internal error", err
+	var serviceErr *serviceError
+	if errors.As(err, &serviceErr) {
+		message = serviceErr.message
+		if serviceErr.err != nil {
+			cause = serviceErr.err
+		}
+	}
+	logFailure(message, cause)
+	return message
+}
+
+// renderServiceError shows an error returned by a service function in the
+// HTMX UI, like writeServiceError does for the JSON API.
+func renderServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	templates.ErrorMessage(publicMessage(err)).Render(r.Context(), w)
+}
@@ -2,43 +2,150 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/gorilla/mux"
 	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/recurrence"
 	"github.com/sergeykhargelia/vct-project/templates"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func (s *Server) CreateRegularExpense(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	userID, ok := r.Context().Value("user_id").(uint64)
+	userID, ok := userIDFromContext(r)
 	if !ok {
 		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
 		return
 	}
 
-	nextDate := r.PostFormValue("nextDate")
-	amount, err := strconv.ParseUint(r.PostFormValue("amount"), 10, 32)
+	if err := r.ParseForm(); err != nil {
+		templates.ErrorMessage("Failed to parse form").Render(r.Context(), w)
+		return
+	}
 
-	if err != nil {
-		templates.ErrorMessage("Failed to parse amount")
+	if _, err := s.createRegularExpense(userID, r.PostForm); err != nil {
+		renderServiceError(w, r, err)
 		return
 	}
 
-	regularExpense := model.RegularExpense{
-		UserID:      userID,
-		Name:        r.PostFormValue("name"),
-		Description: r.PostFormValue("description"),
-		NextDate:    &nextDate,
-		Frequency:   r.PostFormValue("frequency"),
-		Amount:      uint(amount),
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
+
+// createRegularExpense validates the fields of a new regular expense and
+// records it for the user.
+func (s *Server) createRegularExpense(userID uint64, form url.Values) (model.RegularExpense, error) {
+	var regularExpense model.RegularExpense
+
+	name, err := parseName(form.Get("name"))
+	if err != nil {
+		return regularExpense, invalidInput(err)
+	}
+
+	startDate, err := time.Parse(time.DateOnly, form.Get("nextDate"))
+	if err != nil {
+		return regularExpense, invalidInput(errors.New("Invalid next date"))
+	}
+
+	rule, err := parseRecurrence(form)
+	if err != nil {
+		return regularExpense, invalidInput(err)
+	}
+
+	nextDate, err := firstOccurrence(rule, startDate)
+	if err != nil {
+		return regularExpense, invalidInput(err)
+	}
+
+	endDate, err := parseEndDate(form.Get("endDate"), nextDate)
+	if err != nil {
+		return regularExpense, invalidInput(err)
+	}
+
+	maxOccurrences, err := parseMaxOccurrences(form.Get("maxOccurrences"), 0)
+	if err != nil {
+		return regularExpense, invalidInput(err)
+	}
+
+	currency, err := parseCurrency(form.Get("currency"))
+	if err != nil {
+		return regularExpense, invalidInput(err)
+	}
+
+	amount, err := model.ParseMoney(form.Get("amount"), currency)
+	if err != nil {
+		return regularExpense, invalidInput(errors.New("Failed to parse amount"))
+	}
+
+	reminderOffsets, err := normalizeReminderOffsets(form.Get("reminderOffsets"))
+	if err != nil {
+		return regularExpense, invalidInput(err)
+	}
+
+	trial, err := parseTrial(form, currency)
+	if err != nil {
+		return regularExpense, invalidInput(err)
+	}
+
+	categoryID, err := parseCategoryID(form.Get("category"))
+	if err != nil {
+		return regularExpense, invalidInput(err)
+	}
+	if err := s.checkCategory(userID, categoryID); err != nil {
+		return regularExpense, err
+	}
+
+	tags, err := parseTags(form.Get("tags"))
+	if err != nil {
+		return regularExpense, invalidInput(err)
+	}
+
+	regularExpense = model.RegularExpense{
+		UserID:          userID,
+		Name:            name,
+		Description:     form.Get("description"),
+		NextDate:        &nextDate,
+		StartDate:       startDate.Format(time.DateOnly),
+		Recurrence:      rule.String(),
+		Amount:          amount,
+		ReminderOffsets: reminderOffsets,
+		EndDate:         endDate,
+		MaxOccurrences:  maxOccurrences,
+		CategoryID:      categoryID,
+		Tags:            tags,
+	}
+
+	if trial != nil {
+		regularExpense.TrialEndsOn = &trial.endsOn
+		regularExpense.PostTrialAmount = trial.postTrialAmount
+		regularExpense.TrialReminderDays = trial.reminderDays
 	}
 
 	if err := s.DB.Create(&regularExpense).Error; err != nil {
-		templates.ErrorMessage("Error while creating regular expense record")
+		return regularExpense, failure("Error while creating regular expense record", err)
+	}
+
+	return regularExpense, nil
+}
+
+func (s *Server) DeleteRegularExpense(w http.ResponseWriter, r *http.Request) {
+	var regularExpense model.RegularExpense
+	if err := s.findOwned(r, regularExpenseResource, &regularExpense, activeRegularExpense); err != nil {
+		renderLookupError(w, r, regularExpenseResource, err)
+		return
+	}
+
+	if err := s.cancelRegularExpense(regularExpense); err != nil {
+		renderServiceError(w, r, err)
 		return
 	}
 
@@ -46,21 +153,398 @@ func (s *Server) CreateRegularExpense(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (s *Server) DeleteRegularExpense(w http.ResponseWriter, r *http.Request) {
-	regular_expense_id, err := strconv.ParseUint(mux.Vars(r)["regular_expense_id"], 10, 64)
+// cancelRegularExpense stops paying e. The row and its expenses are kept so
+// that the regular expense shows up in the history and can be restored.
+func (s *Server) cancelRegularExpense(e model.RegularExpense) error {
+	err := s.DB.Model(&e).Updates(map[string]any{
+		"status":       model.RegularExpenseCancelled,
+		"cancelled_at": time.Now(),
+	}).Error
+	if err != nil {
+		return failure("Failed to delete regular expense", err)
+	}
+	return nil
+}
+
+// parseCurrency validates a currency code from a form, defaulting to
+// model.DefaultCurrency when it is empty.
+func parseCurrency(value string) (string, error) {
+	if value == "" {
+		return model.DefaultCurrency, nil
+	}
+
+	code := strings.ToUpper(strings.TrimSpace(value))
+	if !model.IsSupportedCurrency(code) {
+		return "", errors.New("Unsupported currency")
+	}
+
+	return code, nil
+}
+
+// normalizeReminderOffsets validates a comma-separated list of reminder
+// offsets from a form and returns it in canonical form.
+func normalizeReminderOffsets(value string) (string, error) {
+	offsets, err := model.ParseReminderOffsets(value)
+	if err != nil {
+		return "", fmt.Errorf("Reminder offsets should be comma-separated numbers of days from 0 to %d", model.MaxReminderOffset)
+	}
+
+	parts := make([]string, len(offsets))
+	for i, offset := range offsets {
+		parts[i] = strconv.Itoa(offset)
+	}
+
+	return strings.Join(parts, ","), nil
+}
+
+var errRecurrenceMissing = errors.New("Recurrence rule is required")
+
+// parseRecurrence reads the recurrence rule of a regular expense form: a
+// custom rule when one is typed in, otherwise the selected preset. It returns
+// errRecurrenceMissing when neither is given.
+func parseRecurrence(form url.Values) (recurrence.Rule, error) {
+	value := strings.TrimSpace(form.Get("customRecurrence"))
+	if value == "" {
+		value = form.Get("recurrence")
+	}
+
+	if value == "" {
+		return recurrence.Rule{}, errRecurrenceMissing
+	}
+
+	rule, err := recurrence.Parse(value)
 	if err != nil {
-		templates.ErrorMessage("Invalid regular expense id").Render(r.Context(), w)
+		return recurrence.Rule{}, fmt.Errorf("Invalid recurrence rule: %v", err)
+	}
+
+	return rule, nil
+}
+
+// firstOccurrence returns the first date on or after start matched by rule.
+func firstOccurrence(rule recurrence.Rule, start time.Time) (string, error) {
+	first, ok := rule.First(start)
+	if !ok {
+		return "", errors.New("Recurrence rule has no dates after the next date")
+	}
+	return first.Format(time.DateOnly), nil
+}
+
+// maxNameLength is the size of the name columns of expenses and regular
+// expenses, in characters.
+const maxNameLength = 50
+
+// parseName trims the name of an expense and checks that it fits its column.
+func parseName(value string) (string, error) {
+	name := strings.TrimSpace(value)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		return "", fmt.Errorf("Name should be non-empty and at most %d characters long", maxNameLength)
+	}
+	return name, nil
+}
+
+// parseEndDate validates an optional end date, which must not come before
+// the next payment. It returns nil when value is empty.
+func parseEndDate(value string, nextDate string) (*string, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, errors.New("Invalid end date")
+	}
+
+	endDate := parsed.Format(time.DateOnly)
+	if endDate < nextDate {
+		return nil, errors.New("End date is before the next payment")
+	}
+
+	return &endDate, nil
+}
+
+// parseMaxOccurrences validates an optional limit on the number of payments,
+// which must leave at least one payment after the paid ones. It returns nil
+// when value is empty.
+func parseMaxOccurrences(value string, paid uint) (*uint, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || parsed == 0 {
+		return nil, errors.New("Number of payments should be a positive number")
+	}
+
+	maxOccurrences := uint(parsed)
+	if maxOccurrences <= paid {
+		return nil, fmt.Errorf("%d payments have already been made", paid)
+	}
+
+	return &maxOccurrences, nil
+}
+
+const defaultTrialReminderDays = 3
+
+type trialSettings struct {
+	endsOn          string
+	postTrialAmount int64
+	reminderDays    uint
+}
+
+// parseTrial validates the trial fields of a regular expense form. It returns
+// nil when no trial end date is given.
+func parseTrial(form url.Values, currency string) (*trialSettings, error) {
+	value := form.Get("trialEndsOn")
+	if value == "" {
+		return nil, nil
+	}
+
+	endsOn, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, errors.New("Invalid trial end date")
+	}
+
+	postTrialPrice, err := model.ParseMoney(form.Get("postTrialAmount"), currency)
+	if err != nil {
+		return nil, errors.New("Price after the trial is required")
+	}
+
+	trial := &trialSettings{
+		endsOn:          endsOn.Format(time.DateOnly),
+		postTrialAmount: postTrialPrice.Minor,
+		reminderDays:    defaultTrialReminderDays,
+	}
+
+	if value := form.Get("trialReminderDays"); value != "" {
+		days, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || days == 0 || days > model.MaxReminderOffset {
+			return nil, fmt.Errorf("Trial warning should be from 1 to %d days before it ends", model.MaxReminderOffset)
+		}
+		trial.reminderDays = uint(days)
+	}
+
+	return trial, nil
+}
+
+type regularExpenseUpdate struct {
+	fields map[string]any
+	// amountChange is set when the new amount takes effect after the next
+	// occurrence and therefore has to wait for it.
+	amountChange *model.AmountChange
+	// appliedFrom is set when the new amount is applied right away and
+	// pending changes up to this date are superseded by it.
+	appliedFrom string
+	// dropChanges is set when the currency changes: pending amount changes
+	// are in minor units of the old currency and are cancelled.
+	dropChanges bool
+}
+
+func parseRegularExpenseUpdate(form url.Values, current model.RegularExpense) (*regularExpenseUpdate, error) {
+	update := &regularExpenseUpdate{fields: map[string]any{}}
+
+	if form.Has("name") {
+		name, err := parseName(form.Get("name"))
+		if err != nil {
+			return nil, err
+		}
+		update.fields["name"] = name
+	}
+
+	if form.Has("description") {
+		update.fields["description"] = strings.TrimSpace(form.Get("description"))
+	}
+
+	if form.Has("category") {
+		categoryID, err := parseCategoryID(form.Get("category"))
+		if err != nil {
+			return nil, err
+		}
+		update.fields["category_id"] = categoryID
+	}
+
+	if form.Has("tags") {
+		tags, err := parseTags(form.Get("tags"))
+		if err != nil {
+			return nil, err
+		}
+		update.fields["tags"] = tags
+	}
+
+	currency := current.Amount.Currency
+	if value := form.Get("currency"); value != "" {
+		parsed, err := parseCurrency(value)
+		if err != nil {
+			return nil, err
+		}
+		if parsed != currency {
+			currency = parsed
+			update.fields["currency"] = currency
+		}
+	}
+
+	if form.Has("reminderOffsets") {
+		reminderOffsets, err := normalizeReminderOffsets(form.Get("reminderOffsets"))
+		if err != nil {
+			return nil, err
+		}
+		update.fields["reminder_offsets"] = reminderOffsets
+	}
+
+	// Changing the next date or the rule restarts the schedule from the next
+	// date, which then moves to the first date the rule matches.
+	nextDate := model.DateOnly(*current.NextDate)
+	startDate := nextDate
+	if value := form.Get("nextDate"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return nil, errors.New("Invalid next date")
+		}
+		startDate = parsed.Format(time.DateOnly)
+	}
+
+	rule, err := parseRecurrence(form)
+	if errors.Is(err, errRecurrenceMissing) {
+		rule, err = recurrence.Parse(current.Recurrence)
+	} else if err == nil && rule.String() != current.Recurrence {
+		update.fields["recurrence"] = rule.String()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if startDate != nextDate || update.fields["recurrence"] != nil {
+		start, _ := time.Parse(time.DateOnly, startDate)
+		if nextDate, err = firstOccurrence(rule, start); err != nil {
+			return nil, err
+		}
+		update.fields["start_date"] = startDate
+		update.fields["next_date"] = nextDate
+	}
+
+	if form.Has("trialEndsOn") {
+		trial, err := parseTrial(form, currency)
+		if err != nil {
+			return nil, err
+		}
+
+		if trial == nil {
+			update.fields["trial_ends_on"] = nil
+		} else {
+			update.fields["trial_ends_on"] = trial.endsOn
+			update.fields["post_trial_amount"] = trial.postTrialAmount
+			update.fields["trial_reminder_days"] = trial.reminderDays
+		}
+	}
+
+	if form.Has("endDate") {
+		endDate, err := parseEndDate(form.Get("endDate"), nextDate)
+		if err != nil {
+			return nil, err
+		}
+		update.fields["end_date"] = endDate
+	}
+
+	if form.Has("maxOccurrences") {
+		maxOccurrences, err := parseMaxOccurrences(form.Get("maxOccurrences"), current.OccurrenceCount)
+		if err != nil {
+			return nil, err
+		}
+		update.fields["max_occurrences"] = maxOccurrences
+	}
+
+	// Amounts are stored in minor units, so a new currency needs a new
+	// amount: the stored one would otherwise be read in the new currency.
+	// There is no telling what a scheduled price or the price after a trial
+	// is in the new currency, so pending amount changes are cancelled and a
+	// trial has to end first.
+	currencyChanged := currency != current.Amount.Currency
+	if currencyChanged {
+		if form.Get("amount") == "" {
+			return nil, errors.New("Amount is required when changing the currency")
+		}
+
+		inTrial := current.TrialEndsOn != nil
+		if trialEndsOn, ok := update.fields["trial_ends_on"]; ok {
+			inTrial = trialEndsOn != nil
+		}
+		if inTrial {
+			return nil, errors.New("Currency can't be changed before the trial ends")
+		}
+		update.dropChanges = true
+	}
+
+	if value := form.Get("amount"); value != "" {
+		amount, err := model.ParseMoney(value, currency)
+		if err != nil {
+			return nil, errors.New("Failed to parse amount")
+		}
+
+		effectiveDate := nextDate
+		if value := form.Get("amountEffectiveDate"); value != "" {
+			parsed, err := time.Parse(time.DateOnly, value)
+			if err != nil {
+				return nil, errors.New("Invalid amount effective date")
+			}
+			effectiveDate = parsed.Format(time.DateOnly)
+		}
+
+		// Occurrences before next_date have already been recorded with their
+		// own amounts, so a change effective by then applies immediately.
+		if effectiveDate <= nextDate {
+			if amount != current.Amount {
+				update.fields["amount"] = amount.Minor
+			}
+			update.appliedFrom = nextDate
+		} else if currencyChanged {
+			return nil, errors.New("Amount in a new currency should take effect from the next payment")
+		} else {
+			update.amountChange = &model.AmountChange{
+				RegularExpenseID: current.ID,
+				EffectiveDate:    effectiveDate,
+				Amount:           amount.Minor,
+			}
+		}
+	}
+
+	if len(update.fields) == 0 && update.amountChange == nil && update.appliedFrom == "" {
+		return nil, errors.New("Nothing to update")
+	}
+
+	return update, nil
+}
+
+func (s *Server) EditRegularExpenseForm(w http.ResponseWriter, r *http.Request) {
+	var regularExpense model.RegularExpense
+	if err := s.findOwned(r, regularExpenseResource, &regularExpense, activeRegularExpense); err != nil {
+		renderLookupError(w, r, regularExpenseResource, err)
 		return
 	}
 
-	result := s.DB.Model(&model.RegularExpense{}).Where("id = ?", regular_expense_id).Update("next_date", nil)
-	if result.Error != nil {
-		templates.ErrorMessage("Failed to delete regular expense").Render(r.Context(), w)
+	categories, err := s.userCategories(regularExpense.UserID)
+	if err != nil {
+		renderServiceError(w, r, failure("Error while finding categories", err))
+		return
+	}
+
+	templates.RegularExpenseEditForm(regularExpense, categories).Render(r.Context(), w)
+}
+
+func (s *Server) UpdateRegularExpense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var regularExpense model.RegularExpense
+	if err := s.findOwned(r, regularExpenseResource, &regularExpense, activeRegularExpense); err != nil {
+		renderLookupError(w, r, regularExpenseResource, err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		templates.ErrorMessage("Failed to parse form").Render(r.Context(), w)
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		templates.ErrorMessage("Regular expense not found").Render(r.Context(), w)
+	if err := s.updateRegularExpense(regularExpense, r.PostForm); err != nil {
+		renderServiceError(w, r, err)
 		return
 	}
 
@@ -68,24 +552,117 @@ func (s *Server) DeleteRegularExpense(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// updateRegularExpense applies the fields present in form to e. A new amount
+// effective after the next payment is scheduled as an amount change.
+func (s *Server) updateRegularExpense(e model.RegularExpense, form url.Values) error {
+	update, err := parseRegularExpenseUpdate(form, e)
+	if err != nil {
+		return invalidInput(err)
+	}
+	if err := s.checkCategoryField(e.UserID, update.fields); err != nil {
+		return err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if len(update.fields) > 0 {
+			if err := tx.Model(&e).Updates(update.fields).Error; err != nil {
+				return err
+			}
+		}
+
+		if update.dropChanges {
+			if err := tx.Where("regular_expense_id = ?", e.ID).Delete(&model.AmountChange{}).Error; err != nil {
+				return err
+			}
+		} else if update.appliedFrom != "" {
+			err := tx.Where("regular_expense_id = ? AND effective_date <= ?", e.ID, update.appliedFrom).
+				Delete(&model.AmountChange{}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if update.amountChange != nil {
+			return tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "regular_expense_id"}, {Name: "effective_date"}},
+				DoUpdates: clause.AssignmentColumns([]string{"amount"}),
+			}).Create(update.amountChange).Error
+		}
+
+		return nil
+	})
+	if err != nil {
+		return failure("Failed to update regular expense", err)
+	}
+
+	return nil
+}
+
 func (s *Server) GetUserRegularExpenses(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(uint64)
+	userID, ok := userIDFromContext(r)
 	if !ok {
 		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
 		return
 	}
 
+	switch status := r.URL.Query().Get("status"); status {
+	case "", model.RegularExpenseActive:
+	case model.RegularExpenseEnded, model.RegularExpenseCancelled:
+		s.regularExpenseHistory(w, r, userID, status)
+		return
+	default:
+		templates.ErrorMessage("Invalid status").Render(r.Context(), w)
+		return
+	}
+
+	query, err := filterByCategoryAndTag(s.DB.Where("user_id = ? AND status = ?", userID, model.RegularExpenseActive), r)
+	if err != nil {
+		templates.ErrorMessage(err.Error()).Render(r.Context(), w)
+		return
+	}
+
 	var regularExpenses []model.RegularExpense
-	if s.DB.Where("user_id = ? AND next_date IS NOT NULL", userID).Order("next_date asc").Find(&regularExpenses).Error != nil {
-		templates.ErrorMessage("Error while finding regular expenses")
+	err = query.Preload("Category").Preload("AmountChanges", preloadAmountChanges).
+		Order("next_date asc").Find(&regularExpenses).Error
+	if err != nil {
+		renderServiceError(w, r, failure("Error while finding regular expenses", err))
 		return
 	}
 
 	templates.ExpensesList(regularExpenses).Render(r.Context(), w)
 }
 
+// filterByDate narrows a query on expenses down to the optional start_date
+// and end_date in the query string, both inclusive.
+func filterByDate(query *gorm.DB, r *http.Request) (*gorm.DB, error) {
+	var startDate, endDate string
+	if value := r.URL.Query().Get("start_date"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return nil, errors.New("Invalid start date")
+		}
+		startDate = parsed.Format(time.DateOnly)
+		query = query.Where("date >= ?", startDate)
+	}
+
+	if value := r.URL.Query().Get("end_date"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return nil, errors.New("Invalid end date")
+		}
+		endDate = parsed.Format(time.DateOnly)
+		query = query.Where("date <= ?", endDate)
+	}
+
+	if startDate != "" && endDate != "" && endDate < startDate {
+		return nil, errors.New("End date must be after start date")
+	}
+
+	return query, nil
+}
+
 func (s *Server) GetUserExpenses(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(uint64)
+	userID, ok := userIDFromContext(r)
 	if !ok {
 		http.Error(w, "Failed to parse user id from request context", http.StatusUnauthorized)
 		return
@@ -108,8 +685,15 @@ func (s *Server) GetUserExpenses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	query, err := filterByCategoryAndTag(s.DB.Where("user_id = ? AND date >= ? AND date <= ?", userID, startDate, endDate), r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var expenses []model.Expense
-	if s.DB.Where("user_id = ? AND date >= ? AND date <= ?", userID, startDate, endDate).Find(&expenses).Error != nil {
+	if err := query.Preload("Category").Find(&expenses).Error; err != nil {
+		logFailure("Error while finding expenses", err)
 		http.Error(w, "Error while finding expenses", http.StatusInternalServerError)
 		return
 	}
@@ -118,3 +702,191 @@ func (s *Server) GetUserExpenses(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(expenses)
 }
+
+// oneOffExpense is the findOwned condition for expenses entered by hand.
+// Occurrences of regular expenses are generated by DoRegularPayments and are
+// not editable by hand.
+const oneOffExpense = "regular_expense_id IS NULL"
+
+// oneOffExpenseFields validates the one-off expense fields present in form
+// and returns them as column values. When required is set, name, amount and
+// date must all be present. An empty currency keeps currentCurrency.
+func oneOffExpenseFields(form url.Values, required bool, currentCurrency string) (map[string]any, error) {
+	fields := map[string]any{}
+
+	if required || form.Has("name") {
+		name, err := parseName(form.Get("name"))
+		if err != nil {
+			return nil, err
+		}
+		fields["name"] = name
+	}
+
+	currency := currentCurrency
+	if value := form.Get("currency"); value != "" {
+		parsed, err := parseCurrency(value)
+		if err != nil {
+			return nil, err
+		}
+		currency = parsed
+	}
+	if required || currency != currentCurrency {
+		fields["currency"] = currency
+	}
+	// The stored amount is in minor units of the current currency.
+	if !required && currency != currentCurrency && !form.Has("amount") {
+		return nil, errors.New("Amount is required when changing the currency")
+	}
+
+	if required || form.Has("amount") {
+		amount, err := model.ParseMoney(form.Get("amount"), currency)
+		if err != nil {
+			return nil, errors.New("Failed to parse amount")
+		}
+		fields["amount"] = amount.Minor
+	}
+
+	if required || form.Has("date") {
+		date, err := time.Parse(time.DateOnly, form.Get("date"))
+		if err != nil {
+			return nil, errors.New("Invalid date")
+		}
+		fields["date"] = date.Format(time.DateOnly)
+	}
+
+	if form.Has("category") {
+		categoryID, err := parseCategoryID(form.Get("category"))
+		if err != nil {
+			return nil, err
+		}
+		fields["category_id"] = categoryID
+	}
+
+	if form.Has("tags") {
+		tags, err := parseTags(form.Get("tags"))
+		if err != nil {
+			return nil, err
+		}
+		fields["tags"] = tags
+	}
+
+	if len(fields) == 0 {
+		return nil, errors.New("Nothing to update")
+	}
+
+	return fields, nil
+}
+
+func (s *Server) CreateExpense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		templates.ErrorMessage("Failed to parse form").Render(r.Context(), w)
+		return
+	}
+
+	if _, err := s.createExpense(userID, r.PostForm); err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
+
+// createExpense validates the fields of a new one-off expense, records it
+// for the user and returns its id.
+func (s *Server) createExpense(userID uint64, form url.Values) (uint64, error) {
+	// Expenses entered without a currency are in the user's base currency.
+	var user model.User
+	if form.Get("currency") == "" {
+		if err := s.DB.First(&user, userID).Error; err != nil {
+			return 0, failure("Failed to find user", err)
+		}
+	}
+
+	fields, err := oneOffExpenseFields(form, true, user.BaseCurrency)
+	if err != nil {
+		return 0, invalidInput(err)
+	}
+	if err := s.checkCategoryField(userID, fields); err != nil {
+		return 0, err
+	}
+
+	// The id is filled in from the RETURNING clause of the insert.
+	fields["user_id"] = userID
+	if err := s.DB.Model(&model.Expense{}).Create(fields).Error; err != nil {
+		return 0, failure("Error while creating expense record", err)
+	}
+
+	id, _ := fields["id"].(uint64)
+	return id, nil
+}
+
+func (s *Server) UpdateExpense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var expense model.Expense
+	if err := s.findOwned(r, expenseResource, &expense, oneOffExpense); err != nil {
+		renderLookupError(w, r, expenseResource, err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		templates.ErrorMessage("Failed to parse form").Render(r.Context(), w)
+		return
+	}
+
+	if err := s.updateExpense(expense, r.PostForm); err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
+
+// updateExpense applies the one-off expense fields present in form to e.
+func (s *Server) updateExpense(e model.Expense, form url.Values) error {
+	fields, err := oneOffExpenseFields(form, false, e.Amount.Currency)
+	if err != nil {
+		return invalidInput(err)
+	}
+	if err := s.checkCategoryField(e.UserID, fields); err != nil {
+		return err
+	}
+
+	if err := s.DB.Model(&e).Updates(fields).Error; err != nil {
+		return failure("Failed to update expense", err)
+	}
+	return nil
+}
+
+func (s *Server) DeleteExpense(w http.ResponseWriter, r *http.Request) {
+	var expense model.Expense
+	if err := s.findOwned(r, expenseResource, &expense, oneOffExpense); err != nil {
+		renderLookupError(w, r, expenseResource, err)
+		return
+	}
+
+	if err := s.deleteExpense(expense); err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) deleteExpense(e model.Expense) error {
+	if err := s.DB.Delete(&e).Error; err != nil {
+		return failure("Failed to delete expense", err)
+	}
+	return nil
+}
@@ -1,5 +1,17 @@
 package server_test
 
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sergeykhargelia/vct-project/server"
+	"github.com/stretchr/testify/assert"
+)
+
 /*import (
 	"bytes"
 	"database/sql/driver"
@@ -332,3 +344,341 @@ func TestDBError(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
 	}
 }*/
+
+func TestCreateExpenseDefaultsToBaseCurrency(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "base_currency"}).AddRow(ownerID, "USD"))
+	mock.ExpectQuery(`INSERT INTO "expenses" \("amount","currency","date","name","user_id"\) VALUES \(\$1,\$2,\$3,\$4,\$5\) RETURNING "id"`).
+		WithArgs(int64(1999), "USD", "2026-01-05", "Headphones", ownerID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+	form := url.Values{"name": {"Headphones"}, "amount": {"19.99"}, "date": {"2026-01-05"}}
+	req := newAuthenticatedRequest(http.MethodPost, "/expenses", ownerID, nil, form)
+	w := httptest.NewRecorder()
+	s.CreateExpense(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "/", w.Header().Get("HX-Redirect"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateExpenseRejectsInvalidFields(t *testing.T) {
+	table := []struct {
+		name    string
+		form    url.Values
+		message string
+	}{
+		{"missing name", url.Values{"amount": {"1"}, "date": {"2026-01-05"}, "currency": {"RUB"}}, "Name should be non-empty"},
+		{"bad amount", url.Values{"name": {"Coffee"}, "amount": {"a lot"}, "date": {"2026-01-05"}, "currency": {"RUB"}}, "Failed to parse amount"},
+		{"bad date", url.Values{"name": {"Coffee"}, "amount": {"1"}, "date": {"05.01.2026"}, "currency": {"RUB"}}, "Invalid date"},
+		{"unknown currency", url.Values{"name": {"Coffee"}, "amount": {"1"}, "date": {"2026-01-05"}, "currency": {"XXX"}}, "Unsupported currency"},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			s, mock := initTestServer(t)
+
+			req := newAuthenticatedRequest(http.MethodPost, "/expenses", ownerID, nil, params.form)
+			w := httptest.NewRecorder()
+			s.CreateExpense(w, req)
+
+			assert.Contains(t, w.Body.String(), params.message)
+			assert.Empty(t, w.Header().Get("HX-Redirect"))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCreateRegularExpenseChecksName(t *testing.T) {
+	table := []struct {
+		name string
+		form url.Values
+	}{
+		{"missing", url.Values{"amount": {"1"}, "nextDate": {"2026-01-05"}, "currency": {"RUB"}}},
+		{"blank", url.Values{"name": {"   "}, "amount": {"1"}, "nextDate": {"2026-01-05"}, "currency": {"RUB"}}},
+		{"too long", url.Values{"name": {strings.Repeat("я", 51)}, "amount": {"1"}, "nextDate": {"2026-01-05"}, "currency": {"RUB"}}},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			s, mock := initTestServer(t)
+
+			req := newAuthenticatedRequest(http.MethodPost, "/regular_expenses", ownerID, nil, params.form)
+			w := httptest.NewRecorder()
+			s.CreateRegularExpense(w, req)
+
+			assert.Contains(t, w.Body.String(), "Name should be non-empty and at most 50 characters long")
+			assert.Empty(t, w.Header().Get("HX-Redirect"))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestNameLengthIsCountedInCharacters(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	// 30 Cyrillic characters take 60 bytes.
+	name := strings.Repeat("я", 30)
+	mock.ExpectQuery(`SELECT \* FROM "expenses" WHERE \(id = \$1 AND user_id = \$2\) AND regular_expense_id IS NULL`).
+		WithArgs(uint64(7), ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "date", "name", "amount", "currency"}).
+			AddRow(7, ownerID, "2026-01-05", "Coffee", 300, "RUB"))
+	mock.ExpectExec(`UPDATE "expenses" SET "name"=\$1 WHERE "id" = \$2`).
+		WithArgs(name, uint64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	form := url.Values{"name": {" " + name + " "}}
+	req := newAuthenticatedRequest(http.MethodPatch, "/expenses/7", ownerID, map[string]string{"expense_id": "7"}, form)
+	w := httptest.NewRecorder()
+	s.UpdateExpense(w, req)
+
+	assert.Equal(t, "/", w.Header().Get("HX-Redirect"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateExpenseKeepsCurrency(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "expenses" WHERE \(id = \$1 AND user_id = \$2\) AND regular_expense_id IS NULL`).
+		WithArgs(uint64(7), ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "date", "name", "amount", "currency"}).
+			AddRow(7, ownerID, "2026-01-05", "Sushi", 3000, "JPY"))
+	// The amount is read in the currency the expense is already in.
+	mock.ExpectExec(`UPDATE "expenses" SET "amount"=\$1,"name"=\$2 WHERE "id" = \$3`).
+		WithArgs(int64(4500), "Ramen", uint64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	form := url.Values{"name": {"Ramen"}, "amount": {"4500"}}
+	req := newAuthenticatedRequest(http.MethodPatch, "/expenses/7", ownerID, map[string]string{"expense_id": "7"}, form)
+	w := httptest.NewRecorder()
+	s.UpdateExpense(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "/", w.Header().Get("HX-Redirect"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteExpense(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "expenses" WHERE \(id = \$1 AND user_id = \$2\) AND regular_expense_id IS NULL`).
+		WithArgs(uint64(7), ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(7, ownerID))
+	mock.ExpectExec(`DELETE FROM "expenses" WHERE "expenses"."id" = \$1`).
+		WithArgs(uint64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := newAuthenticatedRequest(http.MethodDelete, "/expenses/7", ownerID, map[string]string{"expense_id": "7"}, nil)
+	w := httptest.NewRecorder()
+	s.DeleteExpense(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForeignExpenseIsNotChanged(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	table := []struct {
+		name   string
+		method string
+		f      http.HandlerFunc
+	}{
+		{"update", http.MethodPatch, s.UpdateExpense},
+		{"delete", http.MethodDelete, s.DeleteExpense},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			// The lookup is scoped to the caller, so no UPDATE or DELETE
+			// reaches the owner's row.
+			mock.ExpectQuery(`SELECT \* FROM "expenses" WHERE \(id = \$1 AND user_id = \$2\) AND regular_expense_id IS NULL`).
+				WithArgs(uint64(7), intruderID, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}))
+
+			form := url.Values{"amount": {"1"}}
+			req := newAuthenticatedRequest(params.method, "/expenses/7", intruderID, map[string]string{"expense_id": "7"}, form)
+			w := httptest.NewRecorder()
+			params.f(w, req)
+
+			assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+			assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+			assert.Contains(t, w.Body.String(), "Expense not found")
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateRegularExpenseAmount(t *testing.T) {
+	vars := map[string]string{"regular_expense_id": "7"}
+
+	t.Run("effective at the next occurrence", func(t *testing.T) {
+		s, mock := initTestServer(t)
+
+		mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(id = \$1 AND user_id = \$2\) AND status = 'active'`).
+			WithArgs(uint64(7), ownerID, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "recurrence", "amount", "currency"}).
+				AddRow(7, ownerID, "Music", "2026-03-10", "FREQ=MONTHLY", 1000, "RUB"))
+		// The new amount replaces the current one together with any change
+		// scheduled up to the next occurrence.
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "regular_expenses" SET "amount"=\$1 WHERE "id" = \$2`).
+			WithArgs(int64(1250), uint64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM "amount_changes" WHERE regular_expense_id = \$1 AND effective_date <= \$2`).
+			WithArgs(uint64(7), "2026-03-10").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		form := url.Values{"amount": {"12.50"}, "amountEffectiveDate": {"2026-03-10"}}
+		req := newAuthenticatedRequest(http.MethodPatch, "/regular_expenses/7", ownerID, vars, form)
+		w := httptest.NewRecorder()
+		s.UpdateRegularExpense(w, req)
+
+		assert.Equal(t, "/", w.Header().Get("HX-Redirect"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("effective later", func(t *testing.T) {
+		s, mock := initTestServer(t)
+
+		mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(id = \$1 AND user_id = \$2\) AND status = 'active'`).
+			WithArgs(uint64(7), ownerID, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "recurrence", "amount", "currency"}).
+				AddRow(7, ownerID, "Music", "2026-03-10", "FREQ=MONTHLY", 1000, "RUB"))
+		// The current amount is left alone until the change comes into effect.
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO "amount_changes" \("regular_expense_id","effective_date","amount"\) VALUES \(\$1,\$2,\$3\) `+
+			`ON CONFLICT \("regular_expense_id","effective_date"\) DO UPDATE SET "amount"="excluded"."amount" RETURNING "id"`).
+			WithArgs(uint64(7), "2026-04-01", int64(1250)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectCommit()
+
+		form := url.Values{"amount": {"12.50"}, "amountEffectiveDate": {"2026-04-01"}}
+		req := newAuthenticatedRequest(http.MethodPatch, "/regular_expenses/7", ownerID, vars, form)
+		w := httptest.NewRecorder()
+		s.UpdateRegularExpense(w, req)
+
+		assert.Equal(t, "/", w.Header().Get("HX-Redirect"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCurrencyChangeRequiresAmount(t *testing.T) {
+	regularExpenseVars := map[string]string{"regular_expense_id": "7"}
+	expenseVars := map[string]string{"expense_id": "7"}
+
+	table := []struct {
+		name    string
+		target  string
+		vars    map[string]string
+		table   string
+		form    url.Values
+		message string
+		f       func(s *server.Server) http.HandlerFunc
+	}{
+		{
+			"regular expense", "/regular_expenses/7", regularExpenseVars, "regular_expenses",
+			url.Values{"currency": {"JPY"}},
+			"Amount is required when changing the currency",
+			func(s *server.Server) http.HandlerFunc { return s.UpdateRegularExpense },
+		},
+		{
+			"regular expense amount effective later", "/regular_expenses/7", regularExpenseVars, "regular_expenses",
+			url.Values{"currency": {"JPY"}, "amount": {"4500"}, "amountEffectiveDate": {"2026-05-01"}},
+			"Amount in a new currency should take effect from the next payment",
+			func(s *server.Server) http.HandlerFunc { return s.UpdateRegularExpense },
+		},
+		{
+			"one-off expense", "/expenses/7", expenseVars, "expenses",
+			url.Values{"currency": {"JPY"}},
+			"Amount is required when changing the currency",
+			func(s *server.Server) http.HandlerFunc { return s.UpdateExpense },
+		},
+		{
+			"budget", "/budgets/7", map[string]string{"budget_id": "7"}, "budgets",
+			url.Values{"currency": {"JPY"}},
+			"Amount is required when changing the currency",
+			func(s *server.Server) http.HandlerFunc { return s.UpdateBudget },
+		},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			s, mock := initTestServer(t)
+
+			// 299.99 RUB must not turn into 29999 JPY.
+			mock.ExpectQuery(`SELECT \* FROM "`+params.table+`" WHERE \(?id = \$1 AND user_id = \$2`).
+				WithArgs(uint64(7), ownerID, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "next_date", "recurrence", "amount", "currency"}).
+					AddRow(7, ownerID, "2026-03-10", "FREQ=MONTHLY", 29999, "RUB"))
+
+			req := newAuthenticatedRequest(http.MethodPatch, params.target, ownerID, params.vars, params.form)
+			w := httptest.NewRecorder()
+			params.f(s)(w, req)
+
+			assert.Contains(t, w.Body.String(), params.message)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateRegularExpenseCurrencyCancelsPendingChanges(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(id = \$1 AND user_id = \$2\) AND status = 'active'`).
+		WithArgs(uint64(7), ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "recurrence", "amount", "currency"}).
+			AddRow(7, ownerID, "Music", "2026-03-10", "FREQ=MONTHLY", 999, "USD"))
+	// A scheduled 15.00 USD is not 15 JPY, so pending changes are cancelled
+	// rather than carried over.
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "regular_expenses" SET "amount"=\$1,"currency"=\$2 WHERE "id" = \$3`).
+		WithArgs(int64(4500), "JPY", uint64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "amount_changes" WHERE regular_expense_id = \$1$`).
+		WithArgs(uint64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	form := url.Values{"currency": {"JPY"}, "amount": {"4500"}}
+	req := newAuthenticatedRequest(http.MethodPatch, "/regular_expenses/7", ownerID, map[string]string{"regular_expense_id": "7"}, form)
+	w := httptest.NewRecorder()
+	s.UpdateRegularExpense(w, req)
+
+	assert.Equal(t, "/", w.Header().Get("HX-Redirect"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateRegularExpenseCurrencyIsRejectedDuringTrial(t *testing.T) {
+	table := []struct {
+		name string
+		form url.Values
+	}{
+		{"trial kept", url.Values{"currency": {"JPY"}, "amount": {"0"}}},
+		// A price after the trial sent along is still rejected, the edit form
+		// always sends the one it was prefilled with.
+		{"trial resubmitted", url.Values{"currency": {"JPY"}, "amount": {"0"}, "trialEndsOn": {"2026-04-01"}, "postTrialAmount": {"1300"}}},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			s, mock := initTestServer(t)
+
+			mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(id = \$1 AND user_id = \$2\) AND status = 'active'`).
+				WithArgs(uint64(7), ownerID, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "recurrence", "amount", "currency", "trial_ends_on", "post_trial_amount"}).
+					AddRow(7, ownerID, "Music", "2026-03-10", "FREQ=MONTHLY", 0, "USD", "2026-04-01", 1299))
+
+			req := newAuthenticatedRequest(http.MethodPatch, "/regular_expenses/7", ownerID, map[string]string{"regular_expense_id": "7"}, params.form)
+			w := httptest.NewRecorder()
+			s.UpdateRegularExpense(w, req)
+
+			assert.Contains(t, w.Body.String(), "Currency can&#39;t be changed before the trial ends")
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/ical"
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/recurrence"
+	"gorm.io/gorm"
+)
+
+// defaultCalendarDays is how far ahead calendars of regular payments look
+// when no end date is given.
+const defaultCalendarDays = 365
+
+const calendarProdID = "-//vct-project//Regular Expenses Tracker//EN"
+
+// exportedExpense is an expense as written by GET /export.
+type exportedExpense struct {
+	Date             string
+	Name             string
+	Amount           model.Money
+	Category         string
+	Tags             []string
+	RegularExpenseID *uint64
+}
+
+// regularPaymentsCalendar builds a calendar with an event for every upcoming
+// payment of the user's active regular expenses until until. Events have an
+// alarm for every reminder offset of their regular expense.
+func (s *Server) regularPaymentsCalendar(user model.User, until string) (ical.Calendar, error) {
+	calendar := ical.Calendar{ProdID: calendarProdID, Name: "Regular payments"}
+
+	var regularExpenses []model.RegularExpense
+	err := s.DB.Preload("AmountChanges", func(db *gorm.DB) *gorm.DB {
+		return db.Order("effective_date asc")
+	}).Where("user_id = ? AND status = ? AND next_date <= ?", user.ID, model.RegularExpenseActive, until).
+		Order("id").
+		Find(&regularExpenses).Error
+	if err != nil {
+		return calendar, err
+	}
+
+	for _, e := range regularExpenses {
+		e.User = user
+
+		occurrences, err := e.Forecast(until)
+		if err != nil {
+			return calendar, fmt.Errorf("failed to expand schedule of regular expense %d: %w", e.ID, err)
+		}
+
+		schedule := e.Recurrence
+		if rule, err := recurrence.Parse(e.Recurrence); err == nil {
+			schedule = rule.Describe()
+		}
+
+		for _, occurrence := range occurrences {
+			date, err := time.Parse(time.DateOnly, occurrence.Date)
+			if err != nil {
+				return calendar, err
+			}
+
+			description := []string{schedule}
+			if e.Description != "" {
+				description = append(description, e.Description)
+			}
+			if occurrence.Last {
+				description = append(description, "This is the last payment.")
+			}
+
+			calendar.Events = append(calendar.Events, ical.Event{
+				UID:         fmt.Sprintf("regular-expense-%d-%s@vct-project", e.ID, occurrence.Date),
+				Date:        date,
+				Summary:     fmt.Sprintf("%s: %s", e.Name, occurrence.Amount),
+				Description: strings.Join(description, "\n"),
+				Alarms:      e.EffectiveReminderOffsets(),
+			})
+		}
+	}
+
+	return calendar, nil
+}
+
+// Export downloads the user's data: expenses as CSV or JSON, optionally
+// limited to start_date and end_date, or the upcoming payments of regular
+// expenses as an iCalendar file, until the until date or a year ahead.
+func (s *Server) Export(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "Failed to parse user id from request context", http.StatusUnauthorized)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "csv", "json":
+		s.exportExpenses(w, r, userID, format)
+	case "ics":
+		s.exportCalendar(w, r, userID)
+	default:
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+	}
+}
+
+func (s *Server) exportExpenses(w http.ResponseWriter, r *http.Request, userID uint64, format string) {
+	query, err := filterByDate(s.DB.Where("user_id = ?", userID), r)
+	if err == nil {
+		query, err = filterByCategoryAndTag(query, r)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var expenses []model.Expense
+	if err := query.Preload("Category").Order("date, id").Find(&expenses).Error; err != nil {
+		logFailure("Error while finding expenses", err)
+		http.Error(w, "Error while finding expenses", http.StatusInternalServerError)
+		return
+	}
+
+	exported := make([]exportedExpense, len(expenses))
+	for i, e := range expenses {
+		exported[i] = exportedExpense{
+			Date:             model.DateOnly(e.Date),
+			Name:             e.Name,
+			Amount:           e.Amount,
+			Tags:             model.SplitTags(e.Tags),
+			RegularExpenseID: e.RegularExpenseID,
+		}
+		if e.Category != nil {
+			exported[i].Category = e.Category.Name
+		}
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="expenses.json"`)
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(exported); err != nil {
+			logFailure("Failed to write export", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="expenses.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is sent already, so a failed write, usually a client that
+	// went away, can only be logged.
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"date", "name", "amount", "currency", "category", "tags", "regular_expense_id"}); err != nil {
+		logFailure("Failed to write export", err)
+		return
+	}
+	for _, e := range exported {
+		regularExpenseID := ""
+		if e.RegularExpenseID != nil {
+			regularExpenseID = strconv.FormatUint(*e.RegularExpenseID, 10)
+		}
+		err := writer.Write([]string{
+			e.Date,
+			e.Name,
+			e.Amount.Decimal(),
+			e.Amount.Currency,
+			e.Category,
+			strings.Join(e.Tags, ","),
+			regularExpenseID,
+		})
+		if err != nil {
+			logFailure("Failed to write export", err)
+			return
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		logFailure("Failed to write export", err)
+	}
+}
+
+func (s *Server) exportCalendar(w http.ResponseWriter, r *http.Request, userID uint64) {
+	until := time.Now().AddDate(0, 0, defaultCalendarDays).Format(time.DateOnly)
+	if value := r.URL.Query().Get("until"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			http.Error(w, "Invalid until date", http.StatusBadRequest)
+			return
+		}
+		until = parsed.Format(time.DateOnly)
+	}
+
+	if until > time.Now().AddDate(0, 0, maxForecastDays).Format(time.DateOnly) {
+		http.Error(w, fmt.Sprintf("Calendar can look at most %d days ahead", maxForecastDays), http.StatusBadRequest)
+		return
+	}
+
+	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		logFailure("User does not exist", err)
+		http.Error(w, "User does not exist", http.StatusUnauthorized)
+		return
+	}
+
+	calendar, err := s.regularPaymentsCalendar(user, until)
+	if err != nil {
+		logFailure("Error while building calendar", err)
+		http.Error(w, "Error while building calendar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="regular-payments.ics"`)
+	w.WriteHeader(http.StatusOK)
+	if err := calendar.Write(w, time.Now()); err != nil {
+		logFailure("Failed to write calendar", err)
+	}
+}
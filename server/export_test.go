@@ -0,0 +1,118 @@
+package server_test
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportCSV(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "expenses" WHERE user_id = \$1 AND date >= \$2 ORDER BY date, id`).
+		WithArgs(ownerID, "2026-01-01").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "regular_expense_id", "date", "name", "amount", "currency", "category_id", "tags"}).
+			AddRow(1, ownerID, nil, "2026-01-05", "Headphones, wireless", 1299000, "RUB", 3, "gift,music").
+			AddRow(2, ownerID, 7, "2026-01-10", "Gym", 1500, "USD", nil, ""))
+	mock.ExpectQuery(`SELECT \* FROM "categories" WHERE "categories"."id" = \$1`).
+		WithArgs(uint64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name"}).AddRow(3, ownerID, "Other"))
+
+	req := newAuthenticatedRequest(http.MethodGet, "/export?format=csv&start_date=2026-01-01", ownerID, nil, nil)
+	w := httptest.NewRecorder()
+	s.Export(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, strings.Join([]string{
+		"date,name,amount,currency,category,tags,regular_expense_id",
+		`2026-01-05,"Headphones, wireless",12990.00,RUB,Other,"gift,music",`,
+		"2026-01-10,Gym,15.00,USD,,,7",
+		"",
+	}, "\n"), w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// brokenPipe is a response writer whose client went away.
+type brokenPipe struct {
+	*httptest.ResponseRecorder
+}
+
+func (brokenPipe) Write([]byte) (int, error) {
+	return 0, errors.New("write: broken pipe")
+}
+
+func TestExportLogsWriteFailure(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	mock.ExpectQuery(`SELECT \* FROM "expenses" WHERE user_id = \$1 ORDER BY date, id`).
+		WithArgs(ownerID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "date", "name", "amount", "currency"}).
+			AddRow(1, ownerID, "2026-01-05", "Gym", 1500, "USD"))
+
+	req := newAuthenticatedRequest(http.MethodGet, "/export?format=csv", ownerID, nil, nil)
+	s.Export(brokenPipe{httptest.NewRecorder()}, req)
+
+	assert.Contains(t, logged.String(), "Failed to write export: write: broken pipe")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportCalendar(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	until := time.Now().AddDate(0, 0, 40).Format(time.DateOnly)
+	nextDate := time.Now().AddDate(0, 0, 5).Format(time.DateOnly)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "default_reminder_offsets"}).AddRow(ownerID, "First", "1"))
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE user_id = \$1 AND status = \$2 AND next_date <= \$3 ORDER BY id`).
+		WithArgs(ownerID, "active", until).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "amount", "currency", "status", "next_date", "start_date", "recurrence", "reminder_offsets", "max_occurrences"}).
+			AddRow(7, ownerID, "Rent", 3000000, "RUB", "active", nextDate, nextDate, "FREQ=MONTHLY", "7,3", 1))
+	mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE "amount_changes"."regular_expense_id" = \$1 ORDER BY effective_date asc`).
+		WithArgs(uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "regular_expense_id", "amount", "effective_date"}))
+
+	req := newAuthenticatedRequest(http.MethodGet, "/export?format=ics&until="+until, ownerID, nil, nil)
+	w := httptest.NewRecorder()
+	s.Export(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	assert.Equal(t, 1, strings.Count(body, "BEGIN:VEVENT"))
+	assert.Contains(t, body, "UID:regular-expense-7-"+nextDate+"@vct-project\r\n")
+	assert.Contains(t, body, "DTSTART;VALUE=DATE:"+strings.ReplaceAll(nextDate, "-", "")+"\r\n")
+	assert.Contains(t, body, "SUMMARY:Rent: 30000.00 RUB\r\n")
+	assert.Contains(t, body, `This is the last payment.`)
+	assert.Contains(t, body, "TRIGGER:-P7D\r\n")
+	assert.Contains(t, body, "TRIGGER:-P3D\r\n")
+	assert.NotContains(t, body, "TRIGGER:-P1D\r\n")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportRejectsUnknownFormat(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	req := newAuthenticatedRequest(http.MethodGet, "/export?format=xlsx", ownerID, nil, nil)
+	w := httptest.NewRecorder()
+	s.Export(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
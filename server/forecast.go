@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/templates"
+	"gorm.io/gorm"
+)
+
+// defaultForecastDays is how far ahead the forecast looks when no end date is
+// given, and maxForecastDays is the furthest it can look.
+const (
+	defaultForecastDays = 30
+	maxForecastDays     = 731
+)
+
+// Forecast lists the upcoming payments of the user's active regular expenses
+// from today until the given date, 30 days ahead by default, with a running total and a
+// total per month in the user's base currency. The result is JSON, or an HTML
+// fragment for HTMX requests.
+func (s *Server) Forecast(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "Failed to parse user id from request context", http.StatusUnauthorized)
+		return
+	}
+
+	today := time.Now().Format(time.DateOnly)
+	until := time.Now().AddDate(0, 0, defaultForecastDays).Format(time.DateOnly)
+	if value := r.URL.Query().Get("until"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			http.Error(w, "Invalid until date", http.StatusBadRequest)
+			return
+		}
+		until = parsed.Format(time.DateOnly)
+	}
+
+	if until < today {
+		http.Error(w, "Until date must not be in the past", http.StatusBadRequest)
+		return
+	}
+
+	if until > time.Now().AddDate(0, 0, maxForecastDays).Format(time.DateOnly) {
+		http.Error(w, fmt.Sprintf("Forecast can look at most %d days ahead", maxForecastDays), http.StatusBadRequest)
+		return
+	}
+
+	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		logFailure("User does not exist", err)
+		http.Error(w, "User does not exist", http.StatusUnauthorized)
+		return
+	}
+
+	var regularExpenses []model.RegularExpense
+	err := s.DB.Preload("AmountChanges", func(db *gorm.DB) *gorm.DB {
+		return db.Order("effective_date asc")
+	}).Where("user_id = ? AND status = ? AND next_date <= ?", userID, model.RegularExpenseActive, until).
+		Find(&regularExpenses).Error
+	if err != nil {
+		logFailure("Error while finding regular expenses", err)
+		http.Error(w, "Error while finding regular expenses", http.StatusInternalServerError)
+		return
+	}
+
+	forecast := templates.Forecast{
+		Currency:  user.BaseCurrency,
+		StartDate: today,
+		EndDate:   until,
+		Total:     model.Money{Currency: user.BaseCurrency},
+	}
+
+	var currencies []string
+	for _, e := range regularExpenses {
+		occurrences, err := e.Forecast(until)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to expand schedule of regular expense %d", e.ID), http.StatusInternalServerError)
+			return
+		}
+
+		for _, occurrence := range occurrences {
+			// Occurrences overdue since before today are paid by the next run
+			// of DoRegularPayments with their own dates, they are not upcoming.
+			if occurrence.Date < today {
+				continue
+			}
+			forecast.Payments = append(forecast.Payments, templates.ForecastPayment{
+				Date:             occurrence.Date,
+				RegularExpenseID: e.ID,
+				Name:             e.Name,
+				Amount:           occurrence.Amount,
+				Last:             occurrence.Last,
+			})
+		}
+		currencies = append(currencies, e.Amount.Currency)
+	}
+
+	slices.SortStableFunc(forecast.Payments, func(a, b templates.ForecastPayment) int {
+		if c := strings.Compare(a.Date, b.Date); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	rates, err := s.latestRates(user.BaseCurrency, currencies)
+	if err != nil {
+		logFailure("Error while finding exchange rates", err)
+		http.Error(w, "Error while finding exchange rates", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range forecast.Payments {
+		payment := &forecast.Payments[i]
+		month := payment.Date[:len("2006-01")]
+		if n := len(forecast.Months); n == 0 || forecast.Months[n-1].Month != month {
+			forecast.Months = append(forecast.Months, templates.ForecastMonth{
+				Month: month,
+				Total: model.Money{Currency: user.BaseCurrency},
+			})
+		}
+		current := &forecast.Months[len(forecast.Months)-1]
+		current.Count++
+
+		if rate, ok := rates[payment.Amount.Currency]; ok {
+			converted := payment.Amount.Convert(rate, user.BaseCurrency)
+			payment.Converted = &converted
+			forecast.Total.Minor += converted.Minor
+			current.Total.Minor += converted.Minor
+		} else {
+			forecast.Unconverted++
+		}
+		payment.RunningTotal = forecast.Total
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		templates.ForecastPanel(forecast).Render(r.Context(), w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(forecast)
+}
@@ -0,0 +1,109 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/templates"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForecastConvertsIntoBaseCurrencyByMonth(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	now := time.Now()
+	month := func(n int) string {
+		return time.Date(now.Year(), now.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC).Format(time.DateOnly)
+	}
+	until := month(3)
+	yesterday := now.AddDate(0, 0, -1).Format(time.DateOnly)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "base_currency"}).AddRow(ownerID, "RUB"))
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE user_id = \$1 AND status = \$2 AND next_date <= \$3`).
+		WithArgs(ownerID, model.RegularExpenseActive, until).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "start_date", "recurrence", "amount", "currency", "max_occurrences", "status"}).
+			AddRow(1, ownerID, "Cloud", month(1), month(1), "FREQ=MONTHLY", 1000, "USD", nil, "active").
+			AddRow(2, ownerID, "Gym", month(1), month(1), "FREQ=MONTHLY", 5000, "EUR", nil, "active").
+			AddRow(3, ownerID, "Rent", month(1), month(1), "FREQ=MONTHLY", 100000, "RUB", nil, "active").
+			AddRow(4, ownerID, "Domain", month(1), month(1), "FREQ=MONTHLY", 200, "USD", 1, "active").
+			// Yesterday's payment has not been recorded yet, it is overdue
+			// rather than upcoming.
+			AddRow(5, ownerID, "Insurance", yesterday, yesterday, "FREQ=YEARLY", 500000, "RUB", nil, "active"))
+	mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE "amount_changes"."regular_expense_id" IN \(\$1,\$2,\$3,\$4,\$5\) ORDER BY effective_date asc`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "regular_expense_id", "effective_date", "amount"}).
+			AddRow(1, 1, month(2), 1500))
+	// Rates are looked up once per currency, and not at all for the base
+	// currency.
+	mock.ExpectQuery(`SELECT COALESCE\(\s*\(SELECT r\.rate FROM exchange_rates r\s+WHERE r\.from_currency = \$1 AND r\.to_currency = \$2`+
+		`.*\(SELECT 1 / r\.rate FROM exchange_rates r\s+WHERE r\.from_currency = \$3 AND r\.to_currency = \$4`).
+		WithArgs("USD", "RUB", "RUB", "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(90.0))
+	mock.ExpectQuery(`SELECT COALESCE`).
+		WithArgs("EUR", "RUB", "RUB", "EUR").
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(nil))
+
+	req := newAuthenticatedRequest(http.MethodGet, "/forecast?until="+until, ownerID, nil, nil)
+	w := httptest.NewRecorder()
+	s.Forecast(w, req)
+
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var forecast templates.Forecast
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&forecast))
+
+	assert.Len(t, forecast.Payments, 10)
+	for _, payment := range forecast.Payments {
+		assert.GreaterOrEqual(t, payment.Date, forecast.StartDate)
+	}
+	assert.Equal(t, model.Money{Minor: 678000, Currency: "RUB"}, forecast.Total)
+	assert.Equal(t, 3, forecast.Unconverted)
+	// The amount change applies from the second month on, Gym payments have
+	// no rate and are counted but not converted, Domain is paid once.
+	assert.Equal(t, []templates.ForecastMonth{
+		{Month: month(1)[:7], Total: model.Money{Minor: 208000, Currency: "RUB"}, Count: 4},
+		{Month: month(2)[:7], Total: model.Money{Minor: 235000, Currency: "RUB"}, Count: 3},
+		{Month: month(3)[:7], Total: model.Money{Minor: 235000, Currency: "RUB"}, Count: 3},
+	}, forecast.Months)
+
+	first := forecast.Payments[0]
+	assert.Equal(t, "Cloud", first.Name)
+	assert.Equal(t, model.Money{Minor: 1000, Currency: "USD"}, first.Amount)
+	assert.Equal(t, &model.Money{Minor: 90000, Currency: "RUB"}, first.Converted)
+	assert.True(t, forecast.Payments[1].Last, "Domain should be paid only once")
+	assert.Nil(t, forecast.Payments[2].Converted)
+	assert.Equal(t, forecast.Total, forecast.Payments[9].RunningTotal)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForecastRejectsInvalidRange(t *testing.T) {
+	table := []struct {
+		name  string
+		until string
+	}{
+		{"malformed", "next month"},
+		{"past", time.Now().AddDate(0, 0, -1).Format(time.DateOnly)},
+		{"too far", time.Now().AddDate(3, 0, 0).Format(time.DateOnly)},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			s, mock := initTestServer(t)
+
+			req := newAuthenticatedRequest(http.MethodGet, "/forecast", ownerID, nil, nil)
+			req.URL.RawQuery = "until=" + params.until
+			w := httptest.NewRecorder()
+			s.Forecast(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
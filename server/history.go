@@ -0,0 +1,132 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/recurrence"
+	"github.com/sergeykhargelia/vct-project/templates"
+)
+
+// activeRegularExpense is the findOwned condition for regular expenses that
+// are still being paid.
+const activeRegularExpense = "status = '" + model.RegularExpenseActive + "'"
+
+// regularExpenseHistory lists the user's regular expenses with the given
+// status, most recently stopped first, together with how much each one cost
+// over its lifetime in the user's base currency.
+func (s *Server) regularExpenseHistory(w http.ResponseWriter, r *http.Request, userID uint64, status string) {
+	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		renderServiceError(w, r, failure("User does not exist", err))
+		return
+	}
+
+	var regularExpenses []model.RegularExpense
+	err := s.DB.Where("user_id = ? AND status = ?", userID, status).
+		Order("cancelled_at DESC NULLS LAST, id DESC").
+		Find(&regularExpenses).Error
+	if err != nil {
+		renderServiceError(w, r, failure("Error while finding regular expenses", err))
+		return
+	}
+
+	var spent []struct {
+		RegularExpenseID uint64
+		templates.Summary
+	}
+	err = s.DB.Raw(
+		`SELECT regular_expense_id,
+			COALESCE(ROUND(SUM(converted)), 0) AS total,
+			COUNT(*) AS count,
+			COUNT(*) FILTER (WHERE converted IS NULL) AS unconverted
+		FROM (
+			SELECT e.regular_expense_id, `+convertedAmountSQL+` AS converted
+			FROM expenses e
+			JOIN regular_expenses re ON re.id = e.regular_expense_id
+			WHERE re.user_id = @user AND re.status = @status
+		) AS converted_expenses
+		GROUP BY regular_expense_id`,
+		map[string]any{
+			"base":   user.BaseCurrency,
+			"user":   userID,
+			"status": status,
+		},
+	).Scan(&spent).Error
+	if err != nil {
+		renderServiceError(w, r, failure("Error while computing lifetime spend", err))
+		return
+	}
+
+	byID := make(map[uint64]templates.Summary, len(spent))
+	for _, row := range spent {
+		byID[row.RegularExpenseID] = row.Summary
+	}
+
+	history := make([]templates.StoppedExpense, len(regularExpenses))
+	for i, e := range regularExpenses {
+		summary := byID[e.ID]
+		summary.Currency = user.BaseCurrency
+		history[i] = templates.StoppedExpense{RegularExpense: e, Spent: summary}
+	}
+
+	templates.RegularExpenseHistory(history, status, time.Now().Format(time.DateOnly)).Render(r.Context(), w)
+}
+
+// RestoreRegularExpense reactivates a cancelled regular expense. Its schedule
+// restarts from the submitted date, occurrences missed while it was cancelled
+// are not paid, and a pause it had when it was cancelled is dropped.
+func (s *Server) RestoreRegularExpense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var regularExpense model.RegularExpense
+	if err := s.findOwned(r, regularExpenseResource, &regularExpense, "status = '"+model.RegularExpenseCancelled+"'"); err != nil {
+		renderLookupError(w, r, regularExpenseResource, err)
+		return
+	}
+
+	start, err := time.Parse(time.DateOnly, r.PostFormValue("nextDate"))
+	if err != nil {
+		templates.ErrorMessage("Invalid next date").Render(r.Context(), w)
+		return
+	}
+
+	if start.Format(time.DateOnly) < time.Now().Format(time.DateOnly) {
+		templates.ErrorMessage("Next date should not be in the past").Render(r.Context(), w)
+		return
+	}
+
+	rule, err := recurrence.Parse(regularExpense.Recurrence)
+	if err != nil {
+		templates.ErrorMessage("Invalid recurrence rule").Render(r.Context(), w)
+		return
+	}
+
+	nextDate, err := firstOccurrence(rule, start)
+	if err != nil {
+		templates.ErrorMessage(err.Error()).Render(r.Context(), w)
+		return
+	}
+
+	if regularExpense.EndDate != nil && nextDate > model.DateOnly(*regularExpense.EndDate) {
+		templates.ErrorMessage("Next date should not be after the end date").Render(r.Context(), w)
+		return
+	}
+
+	err = s.DB.Model(&regularExpense).Updates(map[string]any{
+		"status":       model.RegularExpenseActive,
+		"cancelled_at": nil,
+		"start_date":   start.Format(time.DateOnly),
+		"next_date":    nextDate,
+		"paused_from":  nil,
+		"paused_until": nil,
+	}).Error
+	if err != nil {
+		renderServiceError(w, r, failure("Failed to restore regular expense", err))
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,35 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreRestartsSchedule(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(time.DateOnly)
+
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(id = \$1 AND user_id = \$2\) AND status = 'cancelled'`).
+		WithArgs(uint64(7), ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "next_date", "start_date", "recurrence", "status", "cancelled_at"}).
+			AddRow(7, ownerID, "2020-01-01", "2020-01-01", "FREQ=DAILY", "cancelled", time.Now()))
+	mock.ExpectExec(`UPDATE "regular_expenses" SET "cancelled_at"=\$1,"next_date"=\$2,"paused_from"=\$3,"paused_until"=\$4,"start_date"=\$5,"status"=\$6 WHERE "id" = \$7`).
+		WithArgs(nil, tomorrow, nil, nil, tomorrow, "active", uint64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	form := url.Values{"nextDate": {tomorrow}}
+	req := newAuthenticatedRequest(http.MethodPost, "/regular_expenses/7/restore", ownerID, map[string]string{"regular_expense_id": "7"}, form)
+	w := httptest.NewRecorder()
+	s.RestoreRegularExpense(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "/", w.Header().Get("HX-Redirect"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
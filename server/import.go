@@ -0,0 +1,203 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sergeykhargelia/vct-project/importer"
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/templates"
+	"gorm.io/gorm/clause"
+)
+
+// maxImportSize bounds the size of an uploaded statement.
+const maxImportSize = 5 << 20
+
+// importBatchSize is how many expenses are inserted per statement.
+const importBatchSize = 500
+
+// importFormat returns the format of an uploaded statement: the submitted
+// one, or otherwise the one its file name suggests.
+func importFormat(value, filename string) (string, error) {
+	switch value {
+	case "csv", "ofx":
+		return value, nil
+	case "":
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".ofx", ".qfx":
+			return "ofx", nil
+		default:
+			return "csv", nil
+		}
+	default:
+		return "", errors.New("Unsupported file format")
+	}
+}
+
+// csvMapping reads the column mapping of a CSV import from the form.
+func csvMapping(r *http.Request, defaultCurrency string) (importer.CSVMapping, error) {
+	mapping := importer.CSVMapping{
+		Date:             r.FormValue("dateColumn"),
+		Amount:           r.FormValue("amountColumn"),
+		Payee:            r.FormValue("payeeColumn"),
+		Currency:         r.FormValue("currencyColumn"),
+		DefaultCurrency:  defaultCurrency,
+		DateFormat:       r.FormValue("dateFormat"),
+		PositiveSpending: r.FormValue("spending") == "positive",
+	}
+
+	if mapping.Date == "" || mapping.Amount == "" || mapping.Payee == "" {
+		return mapping, errors.New("Date, amount and payee columns are required")
+	}
+
+	switch delimiter := r.FormValue("delimiter"); delimiter {
+	case "", ",":
+	case "tab":
+		mapping.Comma = '\t'
+	default:
+		comma, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) || comma == '"' {
+			return mapping, errors.New("Invalid delimiter")
+		}
+		mapping.Comma = comma
+	}
+
+	return mapping, nil
+}
+
+// ImportExpenses records the debits of an uploaded CSV file or OFX statement
+// as one-off expenses. Rows imported before are skipped, so a statement can
+// be uploaded again, or one overlapping it. Payees charged on a regular
+// schedule that the user does not track yet are returned as suggested
+// regular expenses. Rows that cannot be read are reported in the result and
+// do not prevent the rest from being imported. The result is JSON, or an HTML fragment for HTMX
+// requests.
+func (s *Server) ImportExpenses(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "Failed to parse user id from request context", http.StatusUnauthorized)
+		return
+	}
+
+	renderError := func(message string, status int) {
+		if r.Header.Get("HX-Request") == "true" {
+			templates.ErrorMessage(message).Render(r.Context(), w)
+			return
+		}
+		http.Error(w, message, status)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		renderError("Failed to read uploaded file", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		renderError("File is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	format, err := importFormat(r.FormValue("format"), header.Filename)
+	if err != nil {
+		renderError(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		logFailure("User does not exist", err)
+		renderError("User does not exist", http.StatusUnauthorized)
+		return
+	}
+
+	var (
+		transactions []importer.Transaction
+		rowErrors    []importer.RowError
+	)
+	switch format {
+	case "ofx":
+		transactions, rowErrors, err = importer.ParseOFX(file)
+	case "csv":
+		currency := user.BaseCurrency
+		if value := r.FormValue("currency"); value != "" {
+			if currency, err = parseCurrency(value); err != nil {
+				renderError(err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		var mapping importer.CSVMapping
+		if mapping, err = csvMapping(r, currency); err != nil {
+			renderError(err.Error(), http.StatusBadRequest)
+			return
+		}
+		transactions, rowErrors, err = importer.ParseCSV(file, mapping)
+	}
+	if err != nil {
+		renderError("Failed to parse file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := templates.ImportResult{Total: len(transactions), Errors: rowErrors}
+
+	if len(transactions) > 0 {
+		keys := importer.Keys(transactions)
+		expenses := make([]model.Expense, len(transactions))
+		for i, t := range transactions {
+			expenses[i] = model.Expense{
+				UserID:    userID,
+				Date:      t.Date,
+				Name:      t.Payee,
+				Amount:    t.Amount,
+				ImportKey: &keys[i],
+			}
+		}
+
+		inserted := s.DB.Omit(clause.Associations).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			CreateInBatches(&expenses, importBatchSize)
+		if inserted.Error != nil {
+			logFailure("Failed to record imported expenses", inserted.Error)
+			renderError("Failed to record imported expenses", http.StatusInternalServerError)
+			return
+		}
+		result.Imported = int(inserted.RowsAffected)
+	}
+
+	var tracked []string
+	err = s.DB.Model(&model.RegularExpense{}).
+		Where("user_id = ? AND status = ?", userID, model.RegularExpenseActive).
+		Pluck("name", &tracked).Error
+	if err != nil {
+		logFailure("Error while finding regular expenses", err)
+		renderError("Error while finding regular expenses", http.StatusInternalServerError)
+		return
+	}
+	for i, name := range tracked {
+		tracked[i] = importer.NormalizePayee(name)
+	}
+
+	for _, suggestion := range importer.SuggestRecurring(transactions, time.Now().Format(time.DateOnly)) {
+		if !slices.Contains(tracked, importer.NormalizePayee(suggestion.Name)) {
+			result.Suggestions = append(result.Suggestions, suggestion)
+		}
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		templates.ImportResultPanel(result).Render(r.Context(), w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,100 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newUploadRequest(t *testing.T, fields map[string]string, filename, content string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		require.NoError(t, writer.WriteField(name, value))
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/import", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req.WithContext(context.WithValue(req.Context(), "user_id", ownerID))
+}
+
+func TestImportSkipsRowsImportedBefore(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "base_currency"}).AddRow(ownerID, "RUB"))
+	mock.ExpectQuery(`INSERT INTO "expenses" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			ownerID, nil, "2026-01-15", "Spotify", int64(29900), "RUB", nil, "", sqlmock.AnyArg(),
+			ownerID, nil, "2026-02-15", "Spotify", int64(29900), "RUB", nil, "", sqlmock.AnyArg(),
+			ownerID, nil, "2026-03-15", "Spotify", int64(29900), "RUB", nil, "", sqlmock.AnyArg(),
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectQuery(`SELECT "name" FROM "regular_expenses" WHERE user_id = \$1 AND status = \$2`).
+		WithArgs(ownerID, "active").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Internet"))
+
+	file := "Date,Amount,Description\n" +
+		"2026-01-15,-299.00,Spotify\n" +
+		"2026-02-15,-299.00,Spotify\n" +
+		"2026-03-15,-299.00,Spotify\n" +
+		"2026-03-16,5000.00,Salary\n" +
+		"2026-03-17,n/a,Shop\n"
+	fields := map[string]string{"dateColumn": "Date", "amountColumn": "Amount", "payeeColumn": "Description"}
+
+	w := httptest.NewRecorder()
+	s.ImportExpenses(w, newUploadRequest(t, fields, "statement.csv", file))
+
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+
+	var result struct {
+		Total       int
+		Imported    int
+		Errors      []struct{ Row, Message string }
+		Suggestions []struct{ Name, Recurrence string }
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+	assert.Equal(t, 3, result.Total)
+	assert.Equal(t, 1, result.Imported)
+	// The unreadable row is reported, the rest of the file is imported.
+	if assert.Len(t, result.Errors, 1) {
+		assert.Equal(t, "line 6", result.Errors[0].Row)
+	}
+	if assert.Len(t, result.Suggestions, 1) {
+		assert.Equal(t, "Spotify", result.Suggestions[0].Name)
+		assert.Equal(t, "FREQ=MONTHLY;SKIP=BACKWARD", result.Suggestions[0].Recurrence)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportRejectsMissingColumns(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "base_currency"}).AddRow(ownerID, "RUB"))
+
+	fields := map[string]string{"dateColumn": "Date", "amountColumn": "Sum", "payeeColumn": "Description"}
+	w := httptest.NewRecorder()
+	s.ImportExpenses(w, newUploadRequest(t, fields, "statement.csv", "Date,Amount,Description\n"))
+
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), `column "Sum" not found`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"gopkg.in/gomail.v2"
+)
+
+const notifierTimeout = 10 * time.Second
+
+// Message is a notification addressed to a single user.
+type Message struct {
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages to users over a single channel. Channel returns
+// one of the model.Channel* names users pick in their settings.
+type Notifier interface {
+	Channel() string
+	Notify(user model.User, msg Message) error
+}
+
+// EmailNotifier sends messages over SMTP.
+type EmailNotifier struct {
+	Dialer *gomail.Dialer
+}
+
+func (n *EmailNotifier) Channel() string {
+	return model.ChannelEmail
+}
+
+func (n *EmailNotifier) Notify(user model.User, msg Message) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", n.Dialer.Username)
+	m.SetHeader("To", user.Email)
+	m.SetHeader("Subject", msg.Subject)
+	// Emails have always been HTML. The body is plain text with the names
+	// users gave their expenses in it, so it is escaped.
+	m.SetBody("text/html", strings.ReplaceAll(template.HTMLEscapeString(msg.Body), "\n", "<br>\n"))
+
+	return n.Dialer.DialAndSend(m)
+}
+
+// WebhookNotifier posts messages as JSON to the URL configured by the user.
+// The URL is chosen by the user, so the client returned by NewWebhookNotifier
+// refuses to connect to loopback, private and link-local addresses. Checking
+// the address the connection is actually made to also covers DNS records
+// changed after the URL was saved and redirects.
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+type webhookPayload struct {
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+func NewWebhookNotifier() *WebhookNotifier {
+	dialer := &net.Dialer{Timeout: notifierTimeout, Control: dialPublicOnly}
+	return &WebhookNotifier{Client: &http.Client{
+		Timeout:   notifierTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}}
+}
+
+// isPublicAddr reports whether addr may be reached by a webhook. Internal
+// addresses, such as the cloud metadata service at 169.254.169.254, are not.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() &&
+		!addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
+
+// dialPublicOnly is a net.Dialer Control function that aborts connections to
+// addresses that are not public.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("webhook address %s is not public", addrPort.Addr())
+	}
+	return nil
+}
+
+// validateWebhookURL checks a webhook URL entered by a user: it must be an
+// http or https URL whose host resolves to public addresses only.
+func validateWebhookURL(ctx context.Context, raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return errors.New("Invalid webhook URL")
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", parsed.Hostname())
+	if err != nil {
+		return errors.New("Failed to resolve webhook host")
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return errors.New("Webhook URL should point to a public address")
+		}
+	}
+
+	return nil
+}
+
+func (n *WebhookNotifier) Channel() string {
+	return model.ChannelWebhook
+}
+
+func (n *WebhookNotifier) Notify(user model.User, msg Message) error {
+	if user.WebhookURL == "" {
+		return errors.New("webhook url is not configured")
+	}
+
+	return postJSON(n.Client, user.WebhookURL, webhookPayload{
+		Email:   user.Email,
+		Name:    user.Name,
+		Subject: msg.Subject,
+		Body:    msg.Body,
+	})
+}
+
+// ChatBotNotifier sends messages through a Telegram-style bot API: a JSON
+// POST to <Endpoint>/sendMessage with the user's chat id and the text.
+type ChatBotNotifier struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+type chatMessage struct {
+	ChatID string `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+func NewChatBotNotifier(endpoint string) *ChatBotNotifier {
+	return &ChatBotNotifier{
+		Endpoint: strings.TrimRight(endpoint, "/"),
+		Client:   &http.Client{Timeout: notifierTimeout},
+	}
+}
+
+func (n *ChatBotNotifier) Channel() string {
+	return model.ChannelChat
+}
+
+func (n *ChatBotNotifier) Notify(user model.User, msg Message) error {
+	if user.ChatID == "" {
+		return errors.New("chat id is not configured")
+	}
+
+	return postJSON(n.Client, n.Endpoint+"/sendMessage", chatMessage{
+		ChatID: user.ChatID,
+		Text:   msg.Subject + "\n\n" + msg.Body,
+	})
+}
+
+func postJSON(client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,340 @@
+package server_test
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/server"
+	"github.com/stretchr/testify/assert"
+)
+
+type sentMessage struct {
+	user model.User
+	msg  server.Message
+}
+
+type recordingNotifier struct {
+	channel string
+	sent    []sentMessage
+}
+
+func (n *recordingNotifier) Channel() string {
+	return n.channel
+}
+
+func (n *recordingNotifier) Notify(user model.User, msg server.Message) error {
+	n.sent = append(n.sent, sentMessage{user, msg})
+	return nil
+}
+
+func TestNotifyAboutRegularPaymentsEnqueuesDueOffsets(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE status = \$1 AND next_date <= \$2`).
+		WithArgs("active", "2027-01-01").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "amount", "next_date", "start_date", "recurrence", "reminder_offsets"}).
+			AddRow(1, 1, "Internet", 500, "2026-01-02", "2026-01-02", "FREQ=MONTHLY", "").
+			AddRow(2, 1, "Rent", 30000, "2026-01-04", "2026-01-04", "FREQ=MONTHLY", "7,3").
+			AddRow(3, 1, "Trial", 0, "2026-01-05", "2026-01-05", "FREQ=MONTHLY", "7"))
+	mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE "amount_changes"."regular_expense_id" IN \(\$1,\$2,\$3\) ORDER BY effective_date asc`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "notification_channels", "default_reminder_offsets"}).
+			AddRow(1, "first@example.com", "First", "email,webhook", "1"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "notifications" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), "email", "reminder:1:2026-01-02:1d:email", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+			uint64(1), "webhook", "reminder:1:2026-01-02:1d:webhook", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectQuery(`INSERT INTO "notifications" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), "email", "reminder:2:2026-01-04:3d:email", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+			uint64(1), "webhook", "reminder:2:2026-01-04:3d:webhook", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(4))
+	// The second trial should have been warned about on December 27, when
+	// the job did not run.
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE status = \$1 AND trial_ends_on - trial_reminder_days <= \$2 AND trial_ends_on >= \$3`).
+		WithArgs("active", "2026-01-01", "2026-01-01").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "amount", "currency", "trial_ends_on", "post_trial_amount", "trial_reminder_days"}).
+			AddRow(4, 1, "Streaming", 0, "RUB", "2026-01-04", 99900, 3).
+			AddRow(5, 1, "Cloud", 0, "USD", "2026-01-03", 299, 7))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "notification_channels"}).
+			AddRow(1, "first@example.com", "First", "email"))
+	mock.ExpectQuery(`INSERT INTO "notifications" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), "email", "trial:4:2026-01-04:email", "Trial is about to end",
+			"Dear First! Your Streaming trial ends on 2026-01-04, after that you will be charged 999.00 RUB. Cancel it before then if you don't want to keep it.\n",
+			"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery(`INSERT INTO "notifications" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), "email", "trial:5:2026-01-03:email", "Trial is about to end",
+			"Dear First! Your Cloud trial ends on 2026-01-03, after that you will be charged 2.99 USD. Cancel it before then if you don't want to keep it.\n",
+			"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(6))
+	mock.ExpectCommit()
+
+	assert.NoError(t, s.NotifyAboutRegularPayments("2026-01-01"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotifyAboutRegularPaymentsExpandsSchedule(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE status = \$1 AND next_date <= \$2`).
+		WithArgs("active", "2027-01-01").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "amount", "currency", "next_date", "start_date", "recurrence", "reminder_offsets", "paused_from", "paused_until"}).
+			AddRow(1, 1, "Gym", 1000, "RUB", "2026-01-01", "2026-01-01", "FREQ=MONTHLY", "0", nil, nil).
+			AddRow(2, 1, "Cleaning", 150000, "RUB", "2026-01-04", "2026-01-04", "FREQ=WEEKLY", "10", nil, nil).
+			AddRow(3, 1, "Music", 29900, "RUB", "2026-01-05", "2026-01-05", "FREQ=MONTHLY", "35,4", "2026-01-05", "2026-02-01"))
+	mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE "amount_changes"."regular_expense_id" IN \(\$1,\$2,\$3\) ORDER BY effective_date asc`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "regular_expense_id", "effective_date", "amount"}).
+			AddRow(1, 2, "2026-01-11", 160000))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "notification_channels"}).
+			AddRow(1, "first@example.com", "First", "email"))
+	mock.ExpectBegin()
+	// A reminder on the day of the payment, queued before it is paid.
+	mock.ExpectQuery(`INSERT INTO "notifications" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), "email", "reminder:1:2026-01-01:0d:email", "Regular expense is coming",
+			"Dear First! Please, don't forget about your Gym payment of 10.00 RUB, it will be today.\n",
+			"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	// Ten days ahead of a weekly expense is the occurrence after next_date,
+	// which has a new price by then.
+	mock.ExpectQuery(`INSERT INTO "notifications" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), "email", "reminder:2:2026-01-11:10d:email", "Regular expense is coming",
+			"Dear First! Please, don't forget about your Cleaning payment of 1600.00 RUB, it will be in 10 days.\n",
+			"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	// The paused occurrence on January 5 gets no reminder, the first one
+	// after the pause does.
+	mock.ExpectQuery(`INSERT INTO "notifications" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), "email", "reminder:3:2026-02-05:35d:email", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE status = \$1 AND trial_ends_on - trial_reminder_days <= \$2 AND trial_ends_on >= \$3`).
+		WithArgs("active", "2026-01-01", "2026-01-01").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	assert.NoError(t, s.NotifyAboutRegularPayments("2026-01-01"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type failingNotifier struct {
+	channel string
+}
+
+func (n *failingNotifier) Channel() string {
+	return n.channel
+}
+
+func (n *failingNotifier) Notify(user model.User, msg server.Message) error {
+	return errors.New("mailbox unavailable")
+}
+
+// expectClaimNotifications expects the notifications with the given ids to
+// be leased for delivery at now.
+func expectClaimNotifications(mock sqlmock.Sqlmock, now time.Time, rows *sqlmock.Rows, ids ...driver.Value) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "notifications" WHERE status IN \(\$1,\$2\) AND next_attempt_at <= \$3 ORDER BY next_attempt_at LIMIT \$4 FOR UPDATE SKIP LOCKED`).
+		WithArgs("pending", "sending", now, 100).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(1, "first@example.com"))
+	mock.ExpectExec(`UPDATE "notifications" SET "attempts"=attempts \+ 1,"next_attempt_at"=\$1,"status"=\$2 WHERE id IN \(\$3,\$4\)`).
+		WithArgs(append([]driver.Value{now.Add(30 * time.Minute), "sending"}, ids...)...).
+		WillReturnResult(sqlmock.NewResult(0, int64(len(ids))))
+	mock.ExpectCommit()
+}
+
+func TestDeliverNotificationsContinuesAfterFailure(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	webhook := &recordingNotifier{channel: model.ChannelWebhook}
+	s.Notifiers = []server.Notifier{&failingNotifier{channel: model.ChannelEmail}, webhook}
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// The claim is committed before anything is sent, and each result is
+	// then recorded by a statement of its own.
+	expectClaimNotifications(mock, now, sqlmock.NewRows([]string{"id", "user_id", "channel", "subject", "body", "status", "attempts"}).
+		AddRow(1, 1, "email", "Subject", "Body", "pending", 0).
+		AddRow(2, 1, "webhook", "Subject", "Body", "pending", 0), uint64(1), uint64(2))
+	mock.ExpectExec(`UPDATE "notifications" SET .*"status"=\$6,"attempts"=\$7,"next_attempt_at"=\$8,"last_error"=\$9`).
+		WithArgs(
+			uint64(1), "email", sqlmock.AnyArg(), "Subject", "Body",
+			"pending", uint(1), now.Add(time.Minute), "mailbox unavailable", sqlmock.AnyArg(), nil, uint64(1),
+		).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "notifications" SET .*"status"=\$6`).
+		WithArgs(
+			uint64(1), "webhook", sqlmock.AnyArg(), "Subject", "Body",
+			"sent", uint(1), sqlmock.AnyArg(), "", sqlmock.AnyArg(), &now, uint64(2),
+		).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, s.DeliverNotifications(now))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Len(t, webhook.sent, 1)
+}
+
+func TestDeliverNotificationsRecordsResultsSeparately(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	email := &recordingNotifier{channel: model.ChannelEmail}
+	s.Notifiers = []server.Notifier{email}
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// A notification whose lease ran out while sending is picked up again.
+	expectClaimNotifications(mock, now, sqlmock.NewRows([]string{"id", "user_id", "channel", "subject", "body", "status", "attempts"}).
+		AddRow(1, 1, "email", "First", "Body", "sending", 1).
+		AddRow(2, 1, "email", "Second", "Body", "pending", 0), uint64(1), uint64(2))
+	mock.ExpectExec(`UPDATE "notifications" SET .*"status"=\$6`).
+		WithArgs(
+			uint64(1), "email", sqlmock.AnyArg(), "First", "Body",
+			"sent", uint(2), sqlmock.AnyArg(), "", sqlmock.AnyArg(), &now, uint64(1),
+		).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectExec(`UPDATE "notifications" SET .*"status"=\$6`).
+		WithArgs(
+			uint64(1), "email", sqlmock.AnyArg(), "Second", "Body",
+			"sent", uint(1), sqlmock.AnyArg(), "", sqlmock.AnyArg(), &now, uint64(2),
+		).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Failing to record the first result neither unsends the second
+	// notification nor loses its result.
+	assert.ErrorContains(t, s.DeliverNotifications(now), "notification 1: connection reset")
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Len(t, email.sent, 2)
+}
+
+func TestWebhookNotifierPostsJSON(t *testing.T) {
+	var received map[string]string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer hook.Close()
+
+	// The test server listens on loopback, which NewWebhookNotifier refuses.
+	notifier := &server.WebhookNotifier{Client: hook.Client()}
+	user := model.User{Email: "first@example.com", Name: "First", WebhookURL: hook.URL}
+	err := notifier.Notify(user, server.Message{Subject: "Subject", Body: "Body"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"email":   "first@example.com",
+		"name":    "First",
+		"subject": "Subject",
+		"body":    "Body",
+	}, received)
+}
+
+func TestWebhookNotifierRefusesInternalAddresses(t *testing.T) {
+	hits := 0
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer hook.Close()
+
+	targets := []string{
+		hook.URL,
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.1/hook",
+		"http://[::1]:8080/hook",
+	}
+
+	notifier := server.NewWebhookNotifier()
+	for _, target := range targets {
+		err := notifier.Notify(model.User{WebhookURL: target}, server.Message{})
+		assert.ErrorContains(t, err, "is not public", target)
+	}
+	assert.Zero(t, hits)
+}
+
+func TestUpdateSettingsRejectsInternalWebhookURL(t *testing.T) {
+	table := []struct {
+		webhookURL string
+		message    string
+	}{
+		{"http://169.254.169.254/latest/meta-data/", "Webhook URL should point to a public address"},
+		{"http://192.168.1.1/hook", "Webhook URL should point to a public address"},
+		{"https://[fe80::1]/hook", "Webhook URL should point to a public address"},
+		{"http://localhost:8080/hook", "Webhook URL should point to a public address"},
+		{"ftp://example.com/hook", "Invalid webhook URL"},
+	}
+
+	for _, params := range table {
+		t.Run(params.webhookURL, func(t *testing.T) {
+			s, mock := initTestServer(t)
+
+			form := url.Values{"webhookUrl": {params.webhookURL}}
+			req := newAuthenticatedRequest(http.MethodPost, "/settings", ownerID, nil, form)
+			w := httptest.NewRecorder()
+			s.UpdateSettings(w, req)
+
+			assert.Contains(t, w.Body.String(), params.message)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestChatBotNotifierSendsToConfiguredEndpoint(t *testing.T) {
+	var path string
+	var received map[string]string
+	bot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer bot.Close()
+
+	notifier := server.NewChatBotNotifier(bot.URL + "/bot123/")
+	err := notifier.Notify(model.User{ChatID: "42"}, server.Message{Subject: "Subject", Body: "Body"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/bot123/sendMessage", path)
+	assert.Equal(t, "42", received["chat_id"])
+	assert.Equal(t, "Subject\n\nBody", received["text"])
+}
+
+func TestChatBotNotifierReportsFailures(t *testing.T) {
+	bot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer bot.Close()
+
+	notifier := server.NewChatBotNotifier(bot.URL)
+	assert.Error(t, notifier.Notify(model.User{ChatID: "42"}, server.Message{}))
+	assert.Error(t, notifier.Notify(model.User{}, server.Message{}))
+}
@@ -0,0 +1,547 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/openapi"
+	"github.com/sergeykhargelia/vct-project/templates"
+)
+
+// Ways an operation is authenticated, see AuthMiddleware and
+// APIAuthMiddleware.
+type authKind int
+
+const (
+	authNone authKind = iota
+	authSession
+	authAPI
+)
+
+var (
+	sessionSecurity = []openapi.SecurityRequirement{{"session": {}}}
+	apiSecurity     = []openapi.SecurityRequirement{{"bearer": {}}, {"session": {}}}
+)
+
+// openAPIBuilder collects the operations of the OpenAPI document. Schemas of
+// JSON bodies are derived from the Go types the handlers encode and decode.
+type openAPIBuilder struct {
+	doc       openapi.Document
+	generator *openapi.Generator
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// add describes the operation on path. Path parameters are taken from the
+// path: ids are integers, anything else a string.
+func (b *openAPIBuilder) add(method, path string, auth authKind, op openapi.Operation) {
+	for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+		schema := openapi.String("")
+		if strings.HasSuffix(match[1], "_id") {
+			schema = b.generator.SchemaOf(uint64(0))
+		}
+		op.Parameters = append([]openapi.Parameter{{Name: match[1], In: "path", Required: true, Schema: schema}}, op.Parameters...)
+	}
+
+	switch auth {
+	case authSession:
+		op.Tags = []string{"web"}
+		op.Security = sessionSecurity
+		op.Responses["303"] = openapi.Response{Description: "Redirect to /login when the session cookie is missing or expired."}
+	case authAPI:
+		op.Tags = []string{"api"}
+		op.Security = apiSecurity
+		op.Responses["401"] = b.apiError("Missing or invalid token.")
+	default:
+		op.Tags = []string{"web"}
+		if strings.HasPrefix(path, "/api/") {
+			op.Tags = []string{"api"}
+		}
+	}
+
+	if b.doc.Paths[path] == nil {
+		b.doc.Paths[path] = openapi.PathItem{}
+	}
+	b.doc.Paths[path][strings.ToLower(method)] = &op
+}
+
+func (b *openAPIBuilder) json(description string, v any) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{"application/json": {Schema: b.generator.SchemaOf(v)}},
+	}
+}
+
+func (b *openAPIBuilder) jsonBody(v any) *openapi.RequestBody {
+	return &openapi.RequestBody{
+		Required: true,
+		Content:  map[string]openapi.MediaType{"application/json": {Schema: b.generator.SchemaOf(v)}},
+	}
+}
+
+func (b *openAPIBuilder) apiError(description string) openapi.Response {
+	return b.json(description, apiError{})
+}
+
+// htmlOrJSON describes the handlers that render a fragment for HTMX and
+// encode v as JSON for everyone else.
+func (b *openAPIBuilder) htmlOrJSON(description string, v any) openapi.Response {
+	response := b.json(description+" HTMX requests, sent with HX-Request: true, get an HTML fragment instead.", v)
+	response.Content["text/html"] = openapi.MediaType{Schema: openapi.String("")}
+	return response
+}
+
+func html(description string) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{"text/html": {Schema: openapi.String("")}},
+	}
+}
+
+// htmxAction is the response of the HTMX form handlers, which render errors
+// in place and tell the page where to go on success.
+func htmxAction(redirect string) openapi.Response {
+	response := html("An error message to show in place, or nothing on success.")
+	response.Headers = map[string]openapi.Header{
+		"HX-Redirect": {Description: "Set to " + redirect + " on success.", Schema: openapi.String("")},
+	}
+	return response
+}
+
+func plain(description string) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{"text/plain": {Schema: openapi.String("")}},
+	}
+}
+
+// formBody describes a URL-encoded form. Every field is optional as far as
+// the document goes; handlers report missing ones.
+func formBody(fields ...string) *openapi.RequestBody {
+	schema := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{}}
+	for _, field := range fields {
+		schema.Properties[field] = openapi.String("")
+	}
+	return &openapi.RequestBody{
+		Required: true,
+		Content:  map[string]openapi.MediaType{"application/x-www-form-urlencoded": {Schema: schema}},
+	}
+}
+
+func query(name, description string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func queryDate(name, description string) openapi.Parameter {
+	return query(name, description, openapi.String("date"))
+}
+
+func queryEnum(name, description string, values ...string) openapi.Parameter {
+	return query(name, description, &openapi.Schema{Type: "string", Enum: values})
+}
+
+var (
+	filterParams = []openapi.Parameter{
+		query("category", "Only expenses in the category with this id.", &openapi.Schema{Type: "integer", Format: "int64"}),
+		query("tag", "Only expenses with this tag.", openapi.String("")),
+	}
+	pageParams = []openapi.Parameter{
+		query("limit", "Page size, 50 by default.", &openapi.Schema{Type: "integer", Format: "int32"}),
+		query("offset", "Number of items to skip.", &openapi.Schema{Type: "integer", Format: "int32"}),
+	}
+	regularExpenseStatus = queryEnum("status", "Status of the regular expenses to list, active by default.",
+		model.RegularExpenseActive, model.RegularExpenseEnded, model.RegularExpenseCancelled)
+
+	regularExpenseForm = []string{"name", "description", "amount", "currency", "recurrence", "customRecurrence", "nextDate", "endDate",
+		"maxOccurrences", "reminderOffsets", "trialEndsOn", "postTrialAmount", "trialReminderDays", "category", "tags"}
+	expenseForm = []string{"name", "date", "amount", "currency", "category", "tags"}
+	budgetForm  = []string{"amount", "currency", "thresholds"}
+)
+
+func newOpenAPIDocument() openapi.Document {
+	b := &openAPIBuilder{
+		doc: openapi.Document{
+			OpenAPI: openapi.Version,
+			Info: openapi.Info{
+				Title:       "Regular Expenses Tracker",
+				Description: "The HTMX web interface and the JSON API under /api/v1.",
+				Version:     "1",
+			},
+			Paths: map[string]openapi.PathItem{},
+			Components: openapi.Components{
+				SecuritySchemes: map[string]openapi.SecurityScheme{
+					"session": {Type: "apiKey", In: "cookie", Name: "token", Description: "Session cookie set by POST /login."},
+					"bearer":  {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "Token issued by POST /api/v1/tokens."},
+				},
+			},
+		},
+		generator: openapi.NewGenerator(),
+	}
+
+	b.generator.Define(model.Money{}, &openapi.Schema{
+		Type:        "object",
+		Description: "An amount as a decimal string in its currency, e.g. 299.99 USD.",
+		Properties: map[string]*openapi.Schema{
+			"amount":   openapi.String(""),
+			"currency": {Type: "string", Enum: model.SupportedCurrencies},
+		},
+		Required: []string{"amount", "currency"},
+	})
+
+	b.add(http.MethodGet, "/register", authNone, openapi.Operation{
+		Summary:   "Registration page",
+		Responses: map[string]openapi.Response{"200": html("The page.")},
+	})
+	b.add(http.MethodPost, "/register", authNone, openapi.Operation{
+		Summary:     "Register and log in",
+		RequestBody: formBody("name", "email", "password"),
+		Responses:   map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodGet, "/login", authNone, openapi.Operation{
+		Summary:   "Login page",
+		Responses: map[string]openapi.Response{"200": html("The page.")},
+	})
+	b.add(http.MethodPost, "/login", authNone, openapi.Operation{
+		Summary:     "Log in",
+		Description: "Sets the session cookie.",
+		RequestBody: formBody("email", "password"),
+		Responses:   map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodGet, "/health", authNone, openapi.Operation{
+		Summary:   "Health check",
+		Responses: map[string]openapi.Response{"200": {Description: "The service is up."}},
+	})
+	b.add(http.MethodGet, "/calendar/{token}.ics", authNone, openapi.Operation{
+		Summary:     "Calendar feed of upcoming payments",
+		Description: "The token is the secret created in the settings.",
+		Responses: map[string]openapi.Response{
+			"200": {Description: "An iCalendar feed.", Content: map[string]openapi.MediaType{"text/calendar": {Schema: openapi.String("")}}},
+			"404": plain("No feed with this token."),
+		},
+	})
+
+	b.add(http.MethodGet, "/", authSession, openapi.Operation{
+		Summary:   "Dashboard",
+		Responses: map[string]openapi.Response{"200": html("The page.")},
+	})
+	b.add(http.MethodPost, "/regular_expenses", authSession, openapi.Operation{
+		Summary:     "Create a regular expense",
+		RequestBody: formBody(regularExpenseForm...),
+		Responses:   map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodGet, "/regular_expenses", authSession, openapi.Operation{
+		Summary:    "List regular expenses",
+		Parameters: slices.Concat([]openapi.Parameter{regularExpenseStatus}, filterParams),
+		Responses:  map[string]openapi.Response{"200": html("The list.")},
+	})
+	b.add(http.MethodPatch, "/regular_expenses/{regular_expense_id}", authSession, openapi.Operation{
+		Summary:     "Update an active regular expense",
+		RequestBody: formBody(slices.Concat(regularExpenseForm, []string{"amountEffectiveDate"})...),
+		Responses:   map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodDelete, "/regular_expenses/{regular_expense_id}", authSession, openapi.Operation{
+		Summary:   "Cancel an active regular expense",
+		Responses: map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodGet, "/regular_expenses/{regular_expense_id}/edit", authSession, openapi.Operation{
+		Summary:   "Form editing a regular expense",
+		Responses: map[string]openapi.Response{"200": html("The form.")},
+	})
+	b.add(http.MethodGet, "/regular_expenses/{regular_expense_id}/pause", authSession, openapi.Operation{
+		Summary:   "Form pausing a regular expense",
+		Responses: map[string]openapi.Response{"200": html("The form.")},
+	})
+	b.add(http.MethodPost, "/regular_expenses/{regular_expense_id}/pause", authSession, openapi.Operation{
+		Summary:     "Pause a regular expense",
+		Description: "Without pausedUntil the pause lasts until the regular expense is resumed.",
+		RequestBody: formBody("pausedFrom", "pausedUntil"),
+		Responses:   map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodPost, "/regular_expenses/{regular_expense_id}/resume", authSession, openapi.Operation{
+		Summary:   "Resume a paused regular expense",
+		Responses: map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodPost, "/regular_expenses/{regular_expense_id}/restore", authSession, openapi.Operation{
+		Summary:   "Restore a cancelled or ended regular expense",
+		Responses: map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodGet, "/expenses", authSession, openapi.Operation{
+		Summary: "List expenses between two dates",
+		Parameters: slices.Concat([]openapi.Parameter{
+			{Name: "start_date", In: "query", Required: true, Schema: openapi.String("date")},
+			{Name: "end_date", In: "query", Required: true, Schema: openapi.String("date")},
+		}, filterParams),
+		Responses: map[string]openapi.Response{
+			"200": b.json("The expenses.", []model.Expense{}),
+			"400": plain("Invalid dates or filters."),
+		},
+	})
+	b.add(http.MethodPost, "/expenses", authSession, openapi.Operation{
+		Summary:     "Record a one-off expense",
+		RequestBody: formBody(expenseForm...),
+		Responses:   map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodGet, "/expenses/summary", authSession, openapi.Operation{
+		Summary:    "Spending summary in the base currency",
+		Parameters: []openapi.Parameter{queryDate("start_date", ""), queryDate("end_date", "")},
+		Responses:  map[string]openapi.Response{"200": html("The summary.")},
+	})
+	b.add(http.MethodPatch, "/expenses/{expense_id}", authSession, openapi.Operation{
+		Summary:     "Update a one-off expense",
+		RequestBody: formBody(expenseForm...),
+		Responses:   map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodDelete, "/expenses/{expense_id}", authSession, openapi.Operation{
+		Summary:   "Delete a one-off expense",
+		Responses: map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodGet, "/stats", authSession, openapi.Operation{
+		Summary: "Spending per period",
+		Parameters: []openapi.Parameter{
+			queryEnum("period", "Length of a period, month by default.", statsPeriods...),
+			queryEnum("group", "Split every period by category or by regular expense.", "category", "regular_expense"),
+			queryDate("start_date", ""),
+			queryDate("end_date", ""),
+		},
+		Responses: map[string]openapi.Response{
+			"200": b.htmlOrJSON("The statistics.", templates.Stats{}),
+			"400": plain("Invalid parameters."),
+		},
+	})
+	b.add(http.MethodGet, "/forecast", authSession, openapi.Operation{
+		Summary:    "Upcoming payments of regular expenses",
+		Parameters: []openapi.Parameter{queryDate("until", "Last day of the forecast.")},
+		Responses: map[string]openapi.Response{
+			"200": b.htmlOrJSON("The forecast.", templates.Forecast{}),
+			"400": plain("Invalid date."),
+		},
+	})
+	b.add(http.MethodGet, "/settings", authSession, openapi.Operation{
+		Summary:   "Settings page",
+		Responses: map[string]openapi.Response{"200": html("The page.")},
+	})
+	b.add(http.MethodPost, "/settings", authSession, openapi.Operation{
+		Summary:     "Update settings",
+		Description: "channels may be repeated.",
+		RequestBody: formBody("channels", "webhookUrl", "chatId", "defaultReminderOffsets", "baseCurrency"),
+		Responses:   map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodPost, "/settings/calendar_token", authSession, openapi.Operation{
+		Summary:     "Create the calendar feed",
+		Description: "Replaces the previous feed URL, if any.",
+		Responses:   map[string]openapi.Response{"200": htmxAction("/settings")},
+	})
+	b.add(http.MethodDelete, "/settings/calendar_token", authSession, openapi.Operation{
+		Summary:   "Revoke the calendar feed",
+		Responses: map[string]openapi.Response{"200": htmxAction("/settings")},
+	})
+	b.add(http.MethodPost, "/categories", authSession, openapi.Operation{
+		Summary:     "Create a category",
+		RequestBody: formBody("name"),
+		Responses:   map[string]openapi.Response{"200": htmxAction("/settings")},
+	})
+	b.add(http.MethodDelete, "/categories/{category_id}", authSession, openapi.Operation{
+		Summary:   "Delete a category",
+		Responses: map[string]openapi.Response{"200": htmxAction("/settings")},
+	})
+	b.add(http.MethodGet, "/export", authSession, openapi.Operation{
+		Summary:     "Export expenses or upcoming payments",
+		Description: "csv and json export expenses, ics the upcoming payments of regular expenses.",
+		Parameters: slices.Concat([]openapi.Parameter{
+			{Name: "format", In: "query", Required: true, Schema: &openapi.Schema{Type: "string", Enum: []string{"csv", "json", "ics"}}},
+			queryDate("start_date", "Expenses from this date."),
+			queryDate("end_date", "Expenses until this date."),
+		}, filterParams, []openapi.Parameter{queryDate("until", "Payments until this date, a year ahead by default.")}),
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "A file to download.",
+				Content: map[string]openapi.MediaType{
+					"text/csv":         {Schema: openapi.String("")},
+					"application/json": {Schema: b.generator.SchemaOf([]exportedExpense{})},
+					"text/calendar":    {Schema: openapi.String("")},
+				},
+			},
+			"400": plain("Invalid parameters."),
+		},
+	})
+	b.add(http.MethodPost, "/import", authSession, openapi.Operation{
+		Summary:     "Import expenses from a bank statement",
+		Description: "CSV statements need the date, amount and payee columns.",
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{"multipart/form-data": {Schema: &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"file":           openapi.String("binary"),
+					"format":         {Type: "string", Enum: []string{"csv", "ofx"}},
+					"currency":       openapi.String(""),
+					"dateColumn":     openapi.String(""),
+					"amountColumn":   openapi.String(""),
+					"payeeColumn":    openapi.String(""),
+					"currencyColumn": openapi.String(""),
+					"dateFormat":     openapi.String(""),
+					"spending":       {Type: "string", Enum: []string{"negative", "positive"}},
+					"delimiter":      openapi.String(""),
+				},
+				Required: []string{"file"},
+			}}},
+		},
+		Responses: map[string]openapi.Response{
+			"200": b.htmlOrJSON("The outcome of the import.", templates.ImportResult{}),
+			"400": plain("Unreadable statement."),
+		},
+	})
+	b.add(http.MethodGet, "/budgets", authSession, openapi.Operation{
+		Summary:   "Budgets and their spending this month",
+		Responses: map[string]openapi.Response{"200": b.htmlOrJSON("The budgets.", []templates.BudgetStatus{})},
+	})
+	b.add(http.MethodPost, "/budgets", authSession, openapi.Operation{
+		Summary:     "Create a budget",
+		Description: "Without a category the budget covers all spending.",
+		RequestBody: formBody(slices.Concat(budgetForm, []string{"category"})...),
+		Responses:   map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodPatch, "/budgets/{budget_id}", authSession, openapi.Operation{
+		Summary:     "Update a budget",
+		RequestBody: formBody(budgetForm...),
+		Responses:   map[string]openapi.Response{"200": htmxAction("/")},
+	})
+	b.add(http.MethodDelete, "/budgets/{budget_id}", authSession, openapi.Operation{
+		Summary:   "Delete a budget",
+		Responses: map[string]openapi.Response{"200": htmxAction("/")},
+	})
+
+	b.add(http.MethodGet, "/api/openapi.json", authNone, openapi.Operation{
+		Summary: "This document",
+		Responses: map[string]openapi.Response{"200": {
+			Description: "The OpenAPI document.",
+			Content:     map[string]openapi.MediaType{"application/json": {Schema: &openapi.Schema{Type: "object"}}},
+		}},
+	})
+	b.add(http.MethodPost, "/api/v1/users", authNone, openapi.Operation{
+		Summary:     "Register",
+		RequestBody: b.jsonBody(registerRequest{}),
+		Responses: map[string]openapi.Response{
+			"201": b.json("The new user.", apiUser{}),
+			"400": b.apiError("Malformed body."),
+			"409": b.apiError("The email is taken."),
+			"422": b.apiError("Invalid fields."),
+		},
+	})
+	b.add(http.MethodPost, "/api/v1/tokens", authNone, openapi.Operation{
+		Summary:     "Issue a token",
+		RequestBody: b.jsonBody(tokenRequest{}),
+		Responses: map[string]openapi.Response{
+			"201": b.json("A token to send as Authorization: Bearer <token>.", apiToken{}),
+			"400": b.apiError("Malformed body."),
+			"401": b.apiError("Wrong email or password."),
+		},
+	})
+	b.add(http.MethodGet, "/api/v1/users/me", authAPI, openapi.Operation{
+		Summary:   "The authenticated user",
+		Responses: map[string]openapi.Response{"200": b.json("The user.", apiUser{})},
+	})
+	b.add(http.MethodGet, "/api/v1/regular_expenses", authAPI, openapi.Operation{
+		Summary:    "List regular expenses",
+		Parameters: slices.Concat([]openapi.Parameter{regularExpenseStatus}, filterParams, pageParams),
+		Responses: map[string]openapi.Response{
+			"200": b.json("A page of regular expenses.", apiPage[apiRegularExpense]{}),
+			"400": b.apiError("Invalid parameters."),
+		},
+	})
+	b.add(http.MethodPost, "/api/v1/regular_expenses", authAPI, openapi.Operation{
+		Summary:     "Create a regular expense",
+		RequestBody: b.jsonBody(regularExpenseRequest{}),
+		Responses: map[string]openapi.Response{
+			"201": b.json("The new regular expense.", apiRegularExpense{}),
+			"400": b.apiError("Malformed body."),
+			"422": b.apiError("Invalid fields."),
+		},
+	})
+	b.add(http.MethodGet, "/api/v1/regular_expenses/{regular_expense_id}", authAPI, openapi.Operation{
+		Summary: "Get a regular expense",
+		Responses: map[string]openapi.Response{
+			"200": b.json("The regular expense.", apiRegularExpense{}),
+			"404": b.apiError("No such regular expense."),
+		},
+	})
+	b.add(http.MethodPatch, "/api/v1/regular_expenses/{regular_expense_id}", authAPI, openapi.Operation{
+		Summary:     "Update an active regular expense",
+		Description: "Changes the fields present in the body. Fields set to null are cleared.",
+		RequestBody: b.jsonBody(regularExpenseRequest{}),
+		Responses: map[string]openapi.Response{
+			"200": b.json("The regular expense.", apiRegularExpense{}),
+			"400": b.apiError("Malformed body."),
+			"404": b.apiError("No such active regular expense."),
+			"422": b.apiError("Invalid fields."),
+		},
+	})
+	b.add(http.MethodDelete, "/api/v1/regular_expenses/{regular_expense_id}", authAPI, openapi.Operation{
+		Summary: "Cancel an active regular expense",
+		Responses: map[string]openapi.Response{
+			"204": {Description: "Cancelled."},
+			"404": b.apiError("No such active regular expense."),
+		},
+	})
+	b.add(http.MethodGet, "/api/v1/expenses", authAPI, openapi.Operation{
+		Summary: "List expenses",
+		Parameters: slices.Concat([]openapi.Parameter{
+			queryDate("start_date", "Expenses from this date."),
+			queryDate("end_date", "Expenses until this date."),
+		}, filterParams, pageParams),
+		Responses: map[string]openapi.Response{
+			"200": b.json("A page of expenses, latest first.", apiPage[apiExpense]{}),
+			"400": b.apiError("Invalid parameters."),
+		},
+	})
+	b.add(http.MethodPost, "/api/v1/expenses", authAPI, openapi.Operation{
+		Summary:     "Record a one-off expense",
+		RequestBody: b.jsonBody(expenseRequest{}),
+		Responses: map[string]openapi.Response{
+			"201": b.json("The new expense.", apiExpense{}),
+			"400": b.apiError("Malformed body."),
+			"422": b.apiError("Invalid fields."),
+		},
+	})
+	b.add(http.MethodGet, "/api/v1/expenses/{expense_id}", authAPI, openapi.Operation{
+		Summary: "Get an expense",
+		Responses: map[string]openapi.Response{
+			"200": b.json("The expense.", apiExpense{}),
+			"404": b.apiError("No such expense."),
+		},
+	})
+	b.add(http.MethodPatch, "/api/v1/expenses/{expense_id}", authAPI, openapi.Operation{
+		Summary:     "Update a one-off expense",
+		Description: "Changes the fields present in the body.",
+		RequestBody: b.jsonBody(expenseRequest{}),
+		Responses: map[string]openapi.Response{
+			"200": b.json("The expense.", apiExpense{}),
+			"400": b.apiError("Malformed body."),
+			"404": b.apiError("No such one-off expense."),
+			"422": b.apiError("Invalid fields."),
+		},
+	})
+	b.add(http.MethodDelete, "/api/v1/expenses/{expense_id}", authAPI, openapi.Operation{
+		Summary: "Delete a one-off expense",
+		Responses: map[string]openapi.Response{
+			"204": {Description: "Deleted."},
+			"404": b.apiError("No such one-off expense."),
+		},
+	})
+
+	b.doc.Components.Schemas = b.generator.Schemas
+	return b.doc
+}
+
+// openAPIDocument is built on first use: the routes and types it describes do
+// not change while the server runs.
+var openAPIDocument = sync.OnceValue(newOpenAPIDocument)
+
+// OpenAPI serves the OpenAPI document describing every route of the service.
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, openAPIDocument())
+}
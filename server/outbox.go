@@ -0,0 +1,150 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	notificationBatchSize   = 100
+	notificationMaxAttempts = 8
+	notificationBaseBackoff = time.Minute
+	notificationMaxBackoff  = 6 * time.Hour
+	// notificationLease is longer than sending a whole batch takes even when
+	// every notifier times out.
+	notificationLease = 30 * time.Minute
+)
+
+// retryDelay is the exponential backoff before the next delivery attempt of a
+// notification that has failed attempts times.
+func retryDelay(attempts uint) time.Duration {
+	delay := notificationBaseBackoff
+	for i := uint(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= notificationMaxBackoff {
+			return notificationMaxBackoff
+		}
+	}
+	return delay
+}
+
+// enqueue adds msg to the outbox once for every channel the user has enabled.
+// Entries whose dedup key is already present are skipped.
+func enqueue(tx *gorm.DB, user model.User, dedupKey string, msg Message, now time.Time) error {
+	var notifications []model.Notification
+	for _, channel := range user.Channels() {
+		notifications = append(notifications, model.Notification{
+			UserID:        user.ID,
+			Channel:       channel,
+			DedupKey:      fmt.Sprintf("%s:%s", dedupKey, channel),
+			Subject:       msg.Subject,
+			Body:          msg.Body,
+			Status:        model.NotificationPending,
+			NextAttemptAt: now,
+		})
+	}
+
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&notifications).Error
+}
+
+// DeliverNotifications sends every pending notification that is due at now.
+// A failed delivery is retried with exponential backoff and moved to the dead
+// state after notificationMaxAttempts attempts, without holding back the
+// notifications queued after it. Notifications are claimed in a short
+// transaction and sent outside of it, so that no row lock is held while
+// waiting for the network and each result is recorded on its own.
+func (s *Server) DeliverNotifications(now time.Time) error {
+	for {
+		batch, err := s.claimNotifications(now)
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for i := range batch {
+			s.deliver(&batch[i], now)
+			if err := s.DB.Omit(clause.Associations).Save(&batch[i]).Error; err != nil {
+				errs = append(errs, fmt.Errorf("notification %d: %w", batch[i].ID, err))
+			}
+		}
+		if len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+
+		if len(batch) < notificationBatchSize {
+			return nil
+		}
+	}
+}
+
+// claimNotifications leases the next batch of due notifications to the
+// caller and counts the attempt. Notifications still sending when their
+// lease is over are due again.
+func (s *Server) claimNotifications(now time.Time) ([]model.Notification, error) {
+	var batch []model.Notification
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Preload("User").
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ? AND next_attempt_at <= ?", []string{model.NotificationPending, model.NotificationSending}, now).
+			Order("next_attempt_at").
+			Limit(notificationBatchSize).
+			Find(&batch).Error
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+
+		ids := make([]uint64, len(batch))
+		for i := range batch {
+			batch[i].Status = model.NotificationSending
+			batch[i].Attempts++
+			batch[i].NextAttemptAt = now.Add(notificationLease)
+			ids[i] = batch[i].ID
+		}
+
+		return tx.Model(&model.Notification{}).Where("id IN ?", ids).Updates(map[string]any{
+			"status":          model.NotificationSending,
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": now.Add(notificationLease),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// deliver sends a claimed notification and sets its state from the result.
+func (s *Server) deliver(n *model.Notification, now time.Time) {
+	var err error
+	if notifier := s.notifier(n.Channel); notifier != nil {
+		err = notifier.Notify(n.User, Message{Subject: n.Subject, Body: n.Body})
+	} else {
+		err = fmt.Errorf("channel %s is not configured", n.Channel)
+	}
+
+	if err == nil {
+		n.Status = model.NotificationSent
+		n.SentAt = &now
+		n.LastError = ""
+		return
+	}
+
+	n.LastError = err.Error()
+	if n.Attempts >= notificationMaxAttempts {
+		n.Status = model.NotificationDead
+		return
+	}
+
+	n.Status = model.NotificationPending
+	n.NextAttemptAt = now.Add(retryDelay(n.Attempts))
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/templates"
+)
+
+func (s *Server) PauseRegularExpenseForm(w http.ResponseWriter, r *http.Request) {
+	var regularExpense model.RegularExpense
+	if err := s.findOwned(r, regularExpenseResource, &regularExpense, activeRegularExpense); err != nil {
+		renderLookupError(w, r, regularExpenseResource, err)
+		return
+	}
+
+	templates.PauseRegularExpenseForm(regularExpense, time.Now().Format(time.DateOnly)).Render(r.Context(), w)
+}
+
+// PauseRegularExpense records a pause window from the submitted date, today
+// by default, until an optional end date. Occurrences within the window are
+// not paid.
+func (s *Server) PauseRegularExpense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var regularExpense model.RegularExpense
+	if err := s.findOwned(r, regularExpenseResource, &regularExpense, activeRegularExpense); err != nil {
+		renderLookupError(w, r, regularExpenseResource, err)
+		return
+	}
+
+	pausedFrom := time.Now().Format(time.DateOnly)
+	if value := r.PostFormValue("pausedFrom"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			templates.ErrorMessage("Invalid pause start date").Render(r.Context(), w)
+			return
+		}
+		pausedFrom = parsed.Format(time.DateOnly)
+	}
+
+	var pausedUntil *string
+	if value := r.PostFormValue("pausedUntil"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			templates.ErrorMessage("Invalid pause end date").Render(r.Context(), w)
+			return
+		}
+
+		until := parsed.Format(time.DateOnly)
+		if until <= pausedFrom {
+			templates.ErrorMessage("Pause should end after it starts").Render(r.Context(), w)
+			return
+		}
+		pausedUntil = &until
+	}
+
+	err := s.DB.Model(&regularExpense).Updates(map[string]any{
+		"paused_from":  pausedFrom,
+		"paused_until": pausedUntil,
+	}).Error
+	if err != nil {
+		renderServiceError(w, r, failure("Failed to pause regular expense", err))
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
+
+// ResumeRegularExpense ends a pause. Occurrences missed during the pause are
+// not paid: next_date moves to the first occurrence of the recurrence rule
+// on or after today.
+func (s *Server) ResumeRegularExpense(w http.ResponseWriter, r *http.Request) {
+	var regularExpense model.RegularExpense
+	if err := s.findOwned(r, regularExpenseResource, &regularExpense, activeRegularExpense, "paused_from IS NOT NULL"); err != nil {
+		renderLookupError(w, r, regularExpenseResource, err)
+		return
+	}
+
+	fields := map[string]any{"paused_from": nil, "paused_until": nil}
+
+	today := time.Now().Format(time.DateOnly)
+	if model.DateOnly(*regularExpense.NextDate) < today {
+		yesterday := time.Now().AddDate(0, 0, -1).Format(time.DateOnly)
+		nextDate, ok, err := regularExpense.OccurrenceAfter(yesterday)
+		if err != nil || !ok {
+			templates.ErrorMessage("Recurrence rule has no dates after today").Render(r.Context(), w)
+			return
+		}
+		fields["next_date"] = nextDate
+	}
+
+	if err := s.DB.Model(&regularExpense).Updates(fields).Error; err != nil {
+		renderServiceError(w, r, failure("Failed to resume regular expense", err))
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,31 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumeSkipsMissedOccurrences(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(id = \$1 AND user_id = \$2\) AND status = 'active' AND paused_from IS NOT NULL`).
+		WithArgs(uint64(7), ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "next_date", "start_date", "recurrence", "paused_from"}).
+			AddRow(7, ownerID, "2020-01-01", "2020-01-01", "FREQ=DAILY", "2020-01-01"))
+	mock.ExpectExec(`UPDATE "regular_expenses" SET "next_date"=\$1,"paused_from"=\$2,"paused_until"=\$3 WHERE "id" = \$4`).
+		WithArgs(time.Now().Format(time.DateOnly), nil, nil, uint64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := newAuthenticatedRequest(http.MethodPost, "/regular_expenses/7/resume", ownerID, map[string]string{"regular_expense_id": "7"}, nil)
+	w := httptest.NewRecorder()
+	s.ResumeRegularExpense(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "/", w.Header().Get("HX-Redirect"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
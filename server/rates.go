@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/templates"
+)
+
+// convertedAmountSQL converts the amount of an expenses row aliased as e
+// into minor units of the currency bound to @base, using the latest rate
+// known on the expense date. Rates are quoted between whole units, so the
+// amount is rescaled by the difference in minor-unit digits of the two
+// currencies. Rates are looked up for the direct pair first and for the
+// inverse pair otherwise. The result is NULL when no rate is known.
+var convertedAmountSQL = `e.amount * CASE WHEN e.currency = @base THEN 1 ELSE COALESCE(
+	(SELECT r.rate FROM exchange_rates r
+		WHERE r.from_currency = e.currency AND r.to_currency = @base AND r.date <= e.date
+		ORDER BY r.date DESC LIMIT 1),
+	(SELECT 1 / r.rate FROM exchange_rates r
+		WHERE r.from_currency = @base AND r.to_currency = e.currency AND r.date <= e.date
+		ORDER BY r.date DESC LIMIT 1)
+) * power(10, ` + currencyExponentSQL("@base") + ` - ` + currencyExponentSQL("e.currency") + `) END`
+
+// currencyExponentSQL returns an SQL expression evaluating to the number of
+// minor-unit digits of the currency code held by expr.
+func currencyExponentSQL(expr string) string {
+	var b strings.Builder
+	b.WriteString("CASE " + expr)
+	for _, code := range model.SupportedCurrencies {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", code, model.CurrencyExponent(code))
+	}
+	b.WriteString(" ELSE 2 END")
+	return b.String()
+}
+
+func (s *Server) SpendingSummary(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
+		return
+	}
+
+	now := time.Now()
+	startDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	endDate := startDate.AddDate(0, 1, -1)
+
+	if value := r.URL.Query().Get("start_date"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			templates.ErrorMessage("Invalid start date").Render(r.Context(), w)
+			return
+		}
+		startDate = parsed
+	}
+
+	if value := r.URL.Query().Get("end_date"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			templates.ErrorMessage("Invalid end date").Render(r.Context(), w)
+			return
+		}
+		endDate = parsed
+	}
+
+	if endDate.Before(startDate) {
+		templates.ErrorMessage("End date must be after start date").Render(r.Context(), w)
+		return
+	}
+
+	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		renderServiceError(w, r, failure("User does not exist", err))
+		return
+	}
+
+	// Scan zeroes the fields missing from the result, so the totals are
+	// scanned first and the rest of the summary is filled in after.
+	var summary templates.Summary
+	err := s.DB.Raw(
+		`SELECT COALESCE(ROUND(SUM(converted)), 0) AS total,
+			COUNT(*) AS count,
+			COUNT(*) FILTER (WHERE converted IS NULL) AS unconverted
+		FROM (
+			SELECT `+convertedAmountSQL+` AS converted
+			FROM expenses e
+			WHERE e.user_id = @user AND e.date >= @start AND e.date <= @end
+		) AS converted_expenses`,
+		map[string]any{
+			"base":  user.BaseCurrency,
+			"user":  userID,
+			"start": startDate.Format(time.DateOnly),
+			"end":   endDate.Format(time.DateOnly),
+		},
+	).Scan(&summary).Error
+	if err != nil {
+		renderServiceError(w, r, failure("Error while computing spending summary", err))
+		return
+	}
+
+	summary.Currency = user.BaseCurrency
+	summary.StartDate = startDate.Format(time.DateOnly)
+	summary.EndDate = endDate.Format(time.DateOnly)
+
+	templates.SpendingSummary(summary).Render(r.Context(), w)
+}
+
+// latestRates returns the latest known rate into base of every currency in
+// currencies, falling back to the inverse pair like convertedAmountSQL.
+// Currencies without any known rate are left out.
+func (s *Server) latestRates(base string, currencies []string) (map[string]float64, error) {
+	rates := map[string]float64{base: 1}
+	for _, currency := range currencies {
+		if _, ok := rates[currency]; ok {
+			continue
+		}
+
+		var rate *float64
+		err := s.DB.Raw(
+			`SELECT COALESCE(
+				(SELECT r.rate FROM exchange_rates r
+					WHERE r.from_currency = @currency AND r.to_currency = @base
+					ORDER BY r.date DESC LIMIT 1),
+				(SELECT 1 / r.rate FROM exchange_rates r
+					WHERE r.from_currency = @base AND r.to_currency = @currency
+					ORDER BY r.date DESC LIMIT 1)
+			)::float8`,
+			map[string]any{"base": base, "currency": currency},
+		).Scan(&rate).Error
+		if err != nil {
+			return nil, err
+		}
+
+		if rate != nil {
+			rates[currency] = *rate
+		}
+	}
+	return rates, nil
+}
@@ -0,0 +1,38 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpendingSummaryConvertsIntoBaseCurrency(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "base_currency"}).AddRow(ownerID, "USD"))
+	// Amounts in the base currency are taken as they are. Others use the
+	// latest direct rate, or the inverse one, and are rescaled from the minor
+	// units of their currency into those of the base currency.
+	mock.ExpectQuery(`SELECT COALESCE\(ROUND\(SUM\(converted\)\), 0\) AS total,.*`+
+		`SELECT e\.amount \* CASE WHEN e\.currency = \$1 THEN 1 ELSE COALESCE\(\s*`+
+		`\(SELECT r\.rate FROM exchange_rates r\s+WHERE r\.from_currency = e\.currency AND r\.to_currency = \$2 AND r\.date <= e\.date\s+ORDER BY r\.date DESC LIMIT 1\),\s*`+
+		`\(SELECT 1 / r\.rate FROM exchange_rates r\s+WHERE r\.from_currency = \$3 AND r\.to_currency = e\.currency AND r\.date <= e\.date\s+ORDER BY r\.date DESC LIMIT 1\)\s*`+
+		`\) \* power\(10, CASE \$4 WHEN 'RUB' THEN 2 .* WHEN 'JPY' THEN 0 ELSE 2 END - CASE e\.currency WHEN 'RUB' THEN 2 .* WHEN 'JPY' THEN 0 ELSE 2 END\) END AS converted\s+`+
+		`FROM expenses e\s+WHERE e\.user_id = \$5 AND e\.date >= \$6 AND e\.date <= \$7`).
+		WithArgs("USD", "USD", "USD", "USD", ownerID, "2026-01-01", "2026-01-31").
+		WillReturnRows(sqlmock.NewRows([]string{"total", "count", "unconverted"}).AddRow(12345, 4, 1))
+
+	req := newAuthenticatedRequest(http.MethodGet, "/expenses/summary?start_date=2026-01-01&end_date=2026-01-31", ownerID, nil, nil)
+	w := httptest.NewRecorder()
+	s.SpendingSummary(w, req)
+
+	assert.Contains(t, w.Body.String(), "Spent 2026-01-01 – 2026-01-31")
+	assert.Contains(t, w.Body.String(), "123.45")
+	assert.Contains(t, w.Body.String(), "1 without an exchange rate to USD are not included")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,11 +3,12 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/sergeykhargelia/vct-project/model"
 	"github.com/sergeykhargelia/vct-project/templates"
-	"gopkg.in/gomail.v2"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Metrics struct {
@@ -18,68 +19,335 @@ func InitMetrics(registerInPrometheus bool) *Metrics {
 }
 
 type Server struct {
-	DB          *gorm.DB
-	Metrics     *Metrics
-	EmailSender *gomail.Dialer
+	DB        *gorm.DB
+	Metrics   *Metrics
+	Notifiers []Notifier
+	// BaseURL is the address users reach the service at, like
+	// https://vct.example.com. Links given out for use outside the app, such
+	// as calendar feeds, start with it.
+	BaseURL string
+}
+
+func (s *Server) notifier(channel string) Notifier {
+	for _, n := range s.Notifiers {
+		if n.Channel() == channel {
+			return n
+		}
+	}
+	return nil
 }
 
 func (s *Server) MainPage(w http.ResponseWriter, r *http.Request) {
-	templates.Dashboard().Render(r.Context(), w)
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
+		return
+	}
+
+	categories, err := s.userCategories(userID)
+	if err != nil {
+		renderServiceError(w, r, failure("Error while finding categories", err))
+		return
+	}
+
+	templates.Dashboard(categories).Render(r.Context(), w)
 }
 
 func (s *Server) Health(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// DoRegularPayments records an expense for every occurrence of a regular
+// expense that is due on or before date, including occurrences missed while
+// the service was down, and moves next_date to the first occurrence of the
+// recurrence rule after date. Running it again for the same date finds
+// nothing to do. Amount changes that have come into effect by an occurrence
+// are applied to the regular expense first. The name, amount, category and
+// tags are copied onto the expense so that later edits of the regular expense
+// keep history intact.
 func (s *Server) DoRegularPayments(date string) error {
 	return s.DB.Transaction(func(tx *gorm.DB) error {
-		var updatedExpenses []model.RegularExpense
-		err := tx.Raw(
-			"UPDATE regular_expenses SET next_date = next_date + frequency WHERE next_date = ? RETURNING *",
-			date,
-		).Scan(&updatedExpenses).Error
+		// Regular expenses paused until further notice are left alone.
+		var due []model.RegularExpense
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("status = ? AND next_date <= ?", model.RegularExpenseActive, date).
+			Where("paused_from IS NULL OR paused_until IS NOT NULL OR paused_from > next_date").
+			Order("id").
+			Find(&due).Error
 
 		if err != nil {
 			return err
 		}
 
-		var expenses []model.Expense
-		for _, regularExpense := range updatedExpenses {
-			expenses = append(expenses, model.Expense{
-				UserID:           regularExpense.UserID,
-				RegularExpenseID: regularExpense.ID,
-				Date:             date,
-			})
+		for _, e := range due {
+			if err := payRegularExpense(tx, e, date); err != nil {
+				return fmt.Errorf("regular expense %d: %w", e.ID, err)
+			}
 		}
 
-		return s.DB.Create(&expenses).Error
+		return nil
 	})
 }
 
+// payRegularExpense records the occurrences of e due on or before date. The
+// row must be locked by the caller. Occurrences within a pause are skipped
+// without being paid, and a pause without an end holds next_date where it
+// is. A trial converts at the first occurrence on or after its end, which is
+// charged the post-trial price. Once the occurrence allowed last by the end
+// date or the occurrence limit is paid, or the rest of the series falls
+// within a pause, the regular expense has ended and the owner is told which
+// payment was the last one.
+func payRegularExpense(tx *gorm.DB, e model.RegularExpense, date string) error {
+	err := tx.Where("regular_expense_id = ?", e.ID).Order("effective_date asc").Find(&e.AmountChanges).Error
+	if err != nil {
+		return err
+	}
+
+	var expenses []model.Expense
+	var last *model.Expense
+
+	schedule := e.Schedule(date)
+	for schedule.Next() {
+		occurrence := schedule.Occurrence()
+		expenses = append(expenses, model.Expense{
+			UserID:           e.UserID,
+			RegularExpenseID: &e.ID,
+			Date:             occurrence.Date,
+			Name:             e.Name,
+			Amount:           occurrence.Amount,
+			CategoryID:       e.CategoryID,
+			Tags:             e.Tags,
+		})
+
+		if occurrence.Last {
+			last = &expenses[len(expenses)-1]
+		}
+	}
+	if err := schedule.Err(); err != nil {
+		return err
+	}
+
+	nextDate, ok := schedule.NextDate()
+	fields := map[string]any{
+		"next_date":        nextDate,
+		"amount":           schedule.Amount().Minor,
+		"occurrence_count": e.OccurrenceCount + uint(len(expenses)),
+	}
+	// A rule without further occurrences ends the regular expense.
+	if !ok {
+		fields["next_date"] = nil
+		fields["status"] = model.RegularExpenseEnded
+	}
+	if schedule.Converted() {
+		fields["trial_ends_on"] = nil
+	}
+	// A pause the schedule has moved past is over.
+	if e.PausedUntil != nil && (!ok || nextDate >= model.DateOnly(*e.PausedUntil)) {
+		fields["paused_from"] = nil
+		fields["paused_until"] = nil
+	}
+
+	if err := tx.Model(&e).Omit(clause.Associations).Updates(fields).Error; err != nil {
+		return err
+	}
+
+	if applied := schedule.AppliedChanges(); len(applied) > 0 {
+		ids := make([]uint64, len(applied))
+		for i, change := range applied {
+			ids[i] = change.ID
+		}
+		if err := tx.Delete(&model.AmountChange{}, ids).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(expenses) > 0 {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&expenses).Error; err != nil {
+			return err
+		}
+	}
+
+	// A series can end without its final payment being flagged, when the
+	// occurrences left before the end date fall within a pause. The last
+	// payment recorded, in this run or an earlier one, is then the last one.
+	if last == nil && !ok {
+		if len(expenses) > 0 {
+			last = &expenses[len(expenses)-1]
+		} else {
+			var recorded model.Expense
+			found := tx.Where("regular_expense_id = ?", e.ID).Order("date desc").Limit(1).Find(&recorded)
+			if found.Error != nil {
+				return found.Error
+			}
+			if found.RowsAffected > 0 {
+				last = &recorded
+			}
+		}
+	}
+
+	if last == nil {
+		return nil
+	}
+
+	var user model.User
+	if err := tx.First(&user, e.UserID).Error; err != nil {
+		return err
+	}
+
+	msg := Message{
+		Subject: "Last payment of a regular expense",
+		Body:    lastPaymentText(user, *last),
+	}
+
+	return enqueue(tx, user, fmt.Sprintf("last_payment:%d:%s", e.ID, last.Date), msg, time.Now())
+}
+
+func lastPaymentText(user model.User, last model.Expense) string {
+	return fmt.Sprintf(
+		"Dear %s! Your %s payment of %s on %s was the last one, no further payments are scheduled.\n",
+		user.Name,
+		last.Name,
+		last.Amount,
+		last.Date,
+	)
+}
+
+func reminderText(user model.User, e model.RegularExpense, occurrence model.Occurrence, offset int) string {
+	when := fmt.Sprintf("in %d days", offset)
+	switch offset {
+	case 0:
+		when = "today"
+	case 1:
+		when = "tomorrow"
+	}
+
+	text := fmt.Sprintf(
+		"Dear %s! Please, don't forget about your %s payment of %s, it will be %s.\n",
+		user.Name,
+		e.Name,
+		occurrence.Amount,
+		when,
+	)
+
+	if occurrence.Last {
+		text += "This is the last payment, no further payments are scheduled.\n"
+	}
+
+	return text
+}
+
+// NotifyAboutRegularPayments queues reminders about upcoming regular
+// expenses for every channel their owners have enabled. The schedule of each
+// regular expense is expanded up to model.MaxReminderOffset days ahead, so
+// that offsets longer than the recurrence period and occurrences after a
+// pause are covered, and a reminder is queued for each occurrence and
+// reminder offset that falls on date, at most once per regular expense, due
+// date and offset. A reminder on the day of the payment needs the occurrence
+// to still be ahead, so this runs before DoRegularPayments for the same date.
+// Owners of trials are also warned before the trial converts. The reminders
+// are delivered by DeliverNotifications.
 func (s *Server) NotifyAboutRegularPayments(date string) error {
+	today, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return err
+	}
+	until := today.AddDate(0, 0, model.MaxReminderOffset).Format(time.DateOnly)
+
 	var regularExpenses []model.RegularExpense
-	err := s.DB.Preload("User").Where("next_date = ?", date).Find(&regularExpenses).Error
+	err = s.DB.Preload("User").
+		Preload("AmountChanges", func(db *gorm.DB) *gorm.DB {
+			return db.Order("effective_date asc")
+		}).
+		Where("status = ? AND next_date <= ?", model.RegularExpenseActive, until).
+		Find(&regularExpenses).Error
 
 	if err != nil {
 		return err
 	}
 
-	for _, e := range regularExpenses {
-		msg := gomail.NewMessage()
-		msg.SetHeader("From", s.EmailSender.Username)
-		msg.SetHeader("To", e.User.Email)
-		msg.SetHeader("Subject", "Regular expense is coming")
-		msg.SetBody("text/html", fmt.Sprintf(
-			"Dear %s! Please, don't forget about your %s payment of %d rubles, it will be tomorrow.\n",
-			e.User.Name,
-			e.Name,
-			e.Amount,
-		))
+	now := time.Now()
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, e := range regularExpenses {
+			// Offsets are sorted in descending order, so the first one is
+			// the furthest ahead a reminder sent today can look.
+			offsets := e.EffectiveReminderOffsets()
+			if len(offsets) == 0 {
+				continue
+			}
+
+			occurrences, err := e.Forecast(today.AddDate(0, 0, offsets[0]).Format(time.DateOnly))
+			if err != nil {
+				return err
+			}
+
+			for _, occurrence := range occurrences {
+				dueDate, err := time.Parse(time.DateOnly, occurrence.Date)
+				if err != nil {
+					return err
+				}
+
+				for _, offset := range offsets {
+					if !dueDate.AddDate(0, 0, -offset).Equal(today) {
+						continue
+					}
+
+					msg := Message{
+						Subject: "Regular expense is coming",
+						Body:    reminderText(e.User, e, occurrence, offset),
+					}
+
+					dedupKey := fmt.Sprintf("reminder:%d:%s:%dd", e.ID, occurrence.Date, offset)
+					if err := enqueue(tx, e.User, dedupKey, msg, now); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return enqueueTrialReminders(tx, date, now)
+	})
+}
+
+// enqueueTrialReminders queues a warning for every trial that converts into
+// a paid subscription within trial_reminder_days after date. Trials whose
+// warning day has passed, because the job did not run that day or the trial
+// was entered later, are warned as long as they have not ended; the dedup
+// key keeps it to one warning per trial end.
+func enqueueTrialReminders(tx *gorm.DB, date string, now time.Time) error {
+	var trials []model.RegularExpense
+	err := tx.Preload("User").
+		Where("status = ? AND trial_ends_on - trial_reminder_days <= ? AND trial_ends_on >= ?", model.RegularExpenseActive, date, date).
+		Find(&trials).Error
 
-		if err := s.EmailSender.DialAndSend(msg); err != nil {
+	if err != nil {
+		return err
+	}
+
+	for _, e := range trials {
+		if e.PausedOn(*e.TrialEndsOn) {
+			continue
+		}
+
+		msg := Message{
+			Subject: "Trial is about to end",
+			Body:    trialReminderText(e.User, e),
+		}
+
+		dedupKey := fmt.Sprintf("trial:%d:%s", e.ID, model.DateOnly(*e.TrialEndsOn))
+		if err := enqueue(tx, e.User, dedupKey, msg, now); err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+func trialReminderText(user model.User, e model.RegularExpense) string {
+	return fmt.Sprintf(
+		"Dear %s! Your %s trial ends on %s, after that you will be charged %s. Cancel it before then if you don't want to keep it.\n",
+		user.Name,
+		e.Name,
+		model.DateOnly(*e.TrialEndsOn),
+		e.PostTrialPrice(),
+	)
+}
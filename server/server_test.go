@@ -1,7 +1,312 @@
 package server_test
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sergeykhargelia/vct-project/server"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func initTestServer(t *testing.T) (*server.Server, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+
+	dialector := postgres.New(postgres.Config{
+		Conn:       mockDB,
+		DriverName: "postgres",
+	})
+
+	gormDB, err := gorm.Open(dialector, &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &server.Server{DB: gormDB, Metrics: server.InitMetrics(false)}, mock
+}
 
 func TestRegularPayments(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(status = \$1 AND next_date <= \$2\) AND \(paused_from IS NULL .*\) ORDER BY id FOR UPDATE`).
+		WithArgs("active", "2026-04-15").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "start_date", "recurrence", "amount", "currency", "category_id", "tags"}).
+			AddRow(1, 1, "Gym", "2026-01-31T00:00:00Z", "2026-01-31T00:00:00Z", "FREQ=MONTHLY;SKIP=BACKWARD", 1000, "RUB", 4, "fitness"))
+	mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE regular_expense_id = \$1 ORDER BY effective_date asc`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "regular_expense_id", "effective_date", "amount"}).
+			AddRow(5, 1, "2026-03-01T00:00:00Z", 1500))
+	// The 31st is clamped to February 28 and returns to the 31st in March.
+	mock.ExpectExec(`UPDATE "regular_expenses" SET "amount"=\$1,"next_date"=\$2,"occurrence_count"=\$3 WHERE "id" = \$4`).
+		WithArgs(int64(1500), "2026-04-30", uint(3), uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "amount_changes" WHERE "amount_changes"."id" = \$1`).
+		WithArgs(uint64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "expenses" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), uint64(1), "2026-01-31", "Gym", int64(1000), "RUB", uint64(4), "fitness", nil,
+			uint64(1), uint64(1), "2026-02-28", "Gym", int64(1000), "RUB", uint64(4), "fitness", nil,
+			uint64(1), uint64(1), "2026-03-31", "Gym", int64(1500), "RUB", uint64(4), "fitness", nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+	mock.ExpectCommit()
+
+	assert.NoError(t, s.DoRegularPayments("2026-04-15"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegularPaymentsApplyAmountChangeFromItsDate(t *testing.T) {
+	table := []struct {
+		name          string
+		effectiveDate string
+		amount        int64
+		applied       bool
+	}{
+		{"effective at the next occurrence", "2026-03-10", 1200, true},
+		{"effective after the next occurrence", "2026-04-01", 1000, false},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			s, mock := initTestServer(t)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(status = \$1 AND next_date <= \$2\)`).
+				WithArgs("active", "2026-03-10").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "start_date", "recurrence", "amount", "currency"}).
+					AddRow(1, 1, "Music", "2026-03-10", "2026-02-10", "FREQ=MONTHLY", 1000, "RUB"))
+			mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE regular_expense_id = \$1 ORDER BY effective_date asc`).
+				WithArgs(uint64(1)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "regular_expense_id", "effective_date", "amount"}).
+					AddRow(3, 1, params.effectiveDate, 1200))
+			mock.ExpectExec(`UPDATE "regular_expenses" SET "amount"=\$1,"next_date"=\$2,"occurrence_count"=\$3 WHERE "id" = \$4`).
+				WithArgs(params.amount, "2026-04-10", uint(1), uint64(1)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			// A change that is not in effect yet is kept for a later run.
+			if params.applied {
+				mock.ExpectExec(`DELETE FROM "amount_changes" WHERE "amount_changes"."id" = \$1`).
+					WithArgs(uint64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectQuery(`INSERT INTO "expenses" .* ON CONFLICT DO NOTHING`).
+				WithArgs(uint64(1), uint64(1), "2026-03-10", "Music", params.amount, "RUB", nil, "", nil).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			mock.ExpectCommit()
+
+			assert.NoError(t, s.DoRegularPayments("2026-03-10"))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRegularPaymentsCatchUpMissedOccurrences(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	// The service was down for three weeks: every missed week is paid by a
+	// single run.
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(status = \$1 AND next_date <= \$2\) AND \(paused_from IS NULL .*\) ORDER BY id FOR UPDATE`).
+		WithArgs("active", "2026-03-22").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "start_date", "recurrence", "amount", "currency"}).
+			AddRow(1, 1, "Cleaning", "2026-03-01", "2026-03-01", "FREQ=WEEKLY", 150000, "RUB"))
+	mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE regular_expense_id = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(`UPDATE "regular_expenses" SET "amount"=\$1,"next_date"=\$2,"occurrence_count"=\$3 WHERE "id" = \$4`).
+		WithArgs(int64(150000), "2026-03-29", uint(4), uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "expenses" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), uint64(1), "2026-03-01", "Cleaning", int64(150000), "RUB", nil, "", nil,
+			uint64(1), uint64(1), "2026-03-08", "Cleaning", int64(150000), "RUB", nil, "", nil,
+			uint64(1), uint64(1), "2026-03-15", "Cleaning", int64(150000), "RUB", nil, "", nil,
+			uint64(1), uint64(1), "2026-03-22", "Cleaning", int64(150000), "RUB", nil, "", nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3).AddRow(4))
+	mock.ExpectCommit()
+
+	assert.NoError(t, s.DoRegularPayments("2026-03-22"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegularPaymentsRunTwiceOnSameDate(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(status = \$1 AND next_date <= \$2\) AND \(paused_from IS NULL .*\) ORDER BY id FOR UPDATE`).
+		WithArgs("active", "2026-03-01").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "start_date", "recurrence", "amount", "currency"}).
+			AddRow(1, 1, "Rent", "2026-03-01", "2026-01-01", "FREQ=MONTHLY", 3000000, "RUB"))
+	mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE regular_expense_id = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(`UPDATE "regular_expenses" SET "amount"=\$1,"next_date"=\$2,"occurrence_count"=\$3 WHERE "id" = \$4`).
+		WithArgs(int64(3000000), "2026-04-01", uint(1), uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "expenses" .* ON CONFLICT DO NOTHING`).
+		WithArgs(uint64(1), uint64(1), "2026-03-01", "Rent", int64(3000000), "RUB", nil, "", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	// next_date has moved past the date, so the second run finds nothing due
+	// and records nothing.
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(status = \$1 AND next_date <= \$2\) AND \(paused_from IS NULL .*\) ORDER BY id FOR UPDATE`).
+		WithArgs("active", "2026-03-01").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	assert.NoError(t, s.DoRegularPayments("2026-03-01"))
+	assert.NoError(t, s.DoRegularPayments("2026-03-01"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegularPaymentsStopAtOccurrenceLimit(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(status = \$1 AND next_date <= \$2\) AND \(paused_from IS NULL .*\) ORDER BY id FOR UPDATE`).
+		WithArgs("active", "2026-04-15").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "start_date", "recurrence", "amount", "currency", "max_occurrences", "occurrence_count"}).
+			AddRow(1, 1, "Loan", "2026-03-01", "2026-01-01", "FREQ=MONTHLY", 10000, "RUB", 3, 2))
+	mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE regular_expense_id = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	// The third installment is the last one even though April 1 is due too.
+	mock.ExpectExec(`UPDATE "regular_expenses" SET "amount"=\$1,"next_date"=\$2,"occurrence_count"=\$3,"status"=\$4 WHERE "id" = \$5`).
+		WithArgs(int64(10000), nil, uint(3), "ended", uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "expenses" .* ON CONFLICT DO NOTHING`).
+		WithArgs(uint64(1), uint64(1), "2026-03-01", "Loan", int64(10000), "RUB", nil, "", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(uint64(1), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "notification_channels"}).AddRow(1, "First", "email"))
+	mock.ExpectQuery(`INSERT INTO "notifications" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), "email", "last_payment:1:2026-03-01:email", "Last payment of a regular expense", sqlmock.AnyArg(),
+			"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, s.DoRegularPayments("2026-04-15"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegularPaymentsConvertTrial(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(status = \$1 AND next_date <= \$2\) AND \(paused_from IS NULL .*\) ORDER BY id FOR UPDATE`).
+		WithArgs("active", "2026-02-01").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "start_date", "recurrence", "amount", "currency", "trial_ends_on", "post_trial_amount"}).
+			AddRow(1, 1, "Streaming", "2026-02-01", "2026-02-01", "FREQ=MONTHLY", 0, "RUB", "2026-02-01", 99900))
+	mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE regular_expense_id = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(`UPDATE "regular_expenses" SET "amount"=\$1,"next_date"=\$2,"occurrence_count"=\$3,"trial_ends_on"=\$4 WHERE "id" = \$5`).
+		WithArgs(int64(99900), "2026-03-01", uint(1), nil, uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "expenses" .* ON CONFLICT DO NOTHING`).
+		WithArgs(uint64(1), uint64(1), "2026-02-01", "Streaming", int64(99900), "RUB", nil, "", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, s.DoRegularPayments("2026-02-01"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegularPaymentsSkipPausedOccurrences(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(status = \$1 AND next_date <= \$2\) AND \(paused_from IS NULL .*\) ORDER BY id FOR UPDATE`).
+		WithArgs("active", "2026-04-15").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "start_date", "recurrence", "amount", "currency", "paused_from", "paused_until"}).
+			AddRow(1, 1, "Gym", "2026-01-10", "2026-01-10", "FREQ=MONTHLY", 300000, "RUB", "2026-02-01", "2026-04-01"))
+	mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE regular_expense_id = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	// February and March fall within the pause, which is over by April.
+	mock.ExpectExec(`UPDATE "regular_expenses" SET "amount"=\$1,"next_date"=\$2,"occurrence_count"=\$3,"paused_from"=\$4,"paused_until"=\$5 WHERE "id" = \$6`).
+		WithArgs(int64(300000), "2026-05-10", uint(2), nil, nil, uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "expenses" .* ON CONFLICT DO NOTHING`).
+		WithArgs(
+			uint64(1), uint64(1), "2026-01-10", "Gym", int64(300000), "RUB", nil, "", nil,
+			uint64(1), uint64(1), "2026-04-10", "Gym", int64(300000), "RUB", nil, "", nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectCommit()
+
+	assert.NoError(t, s.DoRegularPayments("2026-04-15"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegularPaymentsEndWithinPause(t *testing.T) {
+	table := []struct {
+		name     string
+		nextDate string
+		paid     []string
+	}{
+		// March is paid in this run, April falls within the pause and May
+		// is after the end date.
+		{"last payment in this run", "2026-03-10", []string{"2026-03-10"}},
+		// March was paid by an earlier run, which could not tell that it
+		// was the last payment.
+		{"last payment in an earlier run", "2026-04-10", nil},
+	}
+
+	for _, params := range table {
+		t.Run(params.name, func(t *testing.T) {
+			s, mock := initTestServer(t)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT \* FROM "regular_expenses" WHERE \(status = \$1 AND next_date <= \$2\) AND \(paused_from IS NULL .*\) ORDER BY id FOR UPDATE`).
+				WithArgs("active", "2026-04-15").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "next_date", "start_date", "recurrence", "amount", "currency", "end_date", "occurrence_count", "paused_from", "paused_until"}).
+					AddRow(1, 1, "Gym", params.nextDate, "2026-01-10", "FREQ=MONTHLY", 300000, "RUB", "2026-04-30", 2, "2026-04-01", "2026-05-01"))
+			mock.ExpectQuery(`SELECT \* FROM "amount_changes" WHERE regular_expense_id = \$1`).
+				WithArgs(uint64(1)).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectExec(`UPDATE "regular_expenses" SET "amount"=\$1,"next_date"=\$2,"occurrence_count"=\$3,"paused_from"=\$4,"paused_until"=\$5,"status"=\$6 WHERE "id" = \$7`).
+				WithArgs(int64(300000), nil, uint(2+len(params.paid)), nil, nil, "ended", uint64(1)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			if params.paid != nil {
+				mock.ExpectQuery(`INSERT INTO "expenses" .* ON CONFLICT DO NOTHING`).
+					WithArgs(uint64(1), uint64(1), "2026-03-10", "Gym", int64(300000), "RUB", nil, "", nil).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			} else {
+				mock.ExpectQuery(`SELECT \* FROM "expenses" WHERE regular_expense_id = \$1 ORDER BY date desc LIMIT \$2`).
+					WithArgs(uint64(1), 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "regular_expense_id", "date", "name", "amount", "currency"}).
+						AddRow(3, 1, 1, "2026-03-10", "Gym", 300000, "RUB"))
+			}
+			mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+				WithArgs(uint64(1), 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "notification_channels"}).AddRow(1, "First", "email"))
+			mock.ExpectQuery(`INSERT INTO "notifications" .* ON CONFLICT DO NOTHING`).
+				WithArgs(
+					uint64(1), "email", "last_payment:1:2026-03-10:email", "Last payment of a regular expense", sqlmock.AnyArg(),
+					"pending", uint(0), sqlmock.AnyArg(), "", sqlmock.AnyArg(), nil,
+				).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			mock.ExpectCommit()
 
+			assert.NoError(t, s.DoRegularPayments("2026-04-15"))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
 }
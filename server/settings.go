@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/templates"
+)
+
+func (s *Server) availableChannels() []string {
+	var channels []string
+	for _, n := range s.Notifiers {
+		channels = append(channels, n.Channel())
+	}
+	return channels
+}
+
+func (s *Server) SettingsPage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
+		return
+	}
+
+	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		renderServiceError(w, r, failure("User does not exist", err))
+		return
+	}
+
+	categories, err := s.userCategories(userID)
+	if err != nil {
+		renderServiceError(w, r, failure("Error while finding categories", err))
+		return
+	}
+
+	var calendarURL string
+	if user.CalendarToken != nil {
+		calendarURL = s.calendarFeedURL(*user.CalendarToken)
+	}
+
+	templates.SettingsPage(user, s.availableChannels(), categories, calendarURL).Render(r.Context(), w)
+}
+
+func (s *Server) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		templates.ErrorMessage("Failed to parse user id from request context").Render(r.Context(), w)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		templates.ErrorMessage("Failed to parse form").Render(r.Context(), w)
+		return
+	}
+
+	available := s.availableChannels()
+	channels := r.PostForm["channels"]
+	for _, channel := range channels {
+		if !slices.Contains(available, channel) {
+			templates.ErrorMessage("Unknown notification channel").Render(r.Context(), w)
+			return
+		}
+	}
+
+	webhookURL := strings.TrimSpace(r.PostForm.Get("webhookUrl"))
+	if webhookURL != "" {
+		if err := validateWebhookURL(r.Context(), webhookURL); err != nil {
+			templates.ErrorMessage(err.Error()).Render(r.Context(), w)
+			return
+		}
+	}
+
+	if slices.Contains(channels, model.ChannelWebhook) && webhookURL == "" {
+		templates.ErrorMessage("Webhook URL is required for webhook notifications").Render(r.Context(), w)
+		return
+	}
+
+	chatID := strings.TrimSpace(r.PostForm.Get("chatId"))
+	if slices.Contains(channels, model.ChannelChat) && chatID == "" {
+		templates.ErrorMessage("Chat ID is required for chat bot notifications").Render(r.Context(), w)
+		return
+	}
+
+	reminderOffsets, err := normalizeReminderOffsets(r.PostForm.Get("defaultReminderOffsets"))
+	if err != nil {
+		templates.ErrorMessage(err.Error()).Render(r.Context(), w)
+		return
+	}
+
+	baseCurrency, err := parseCurrency(r.PostForm.Get("baseCurrency"))
+	if err != nil {
+		templates.ErrorMessage(err.Error()).Render(r.Context(), w)
+		return
+	}
+
+	err = s.DB.Model(&model.User{ID: userID}).Updates(map[string]any{
+		"notification_channels":    strings.Join(channels, ","),
+		"webhook_url":              webhookURL,
+		"chat_id":                  chatID,
+		"default_reminder_offsets": reminderOffsets,
+		"base_currency":            baseCurrency,
+	}).Error
+	if err != nil {
+		renderServiceError(w, r, failure("Failed to update settings", err))
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
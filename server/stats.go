@@ -0,0 +1,244 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/templates"
+)
+
+// statsPeriods are the periods GET /stats can group by. Each one is both a
+// date_trunc field and an interval unit.
+var statsPeriods = []string{"day", "week", "month", "year"}
+
+// statsGroups maps the groupings GET /stats supports to the expenses column
+// holding the group and the table naming it.
+var statsGroups = map[string]struct {
+	column string
+	table  string
+	// none names the group of expenses with a NULL column.
+	none string
+}{
+	"category":        {"category_id", "categories", "Uncategorized"},
+	"regular_expense": {"regular_expense_id", "regular_expenses", "One-off"},
+}
+
+// maxStatsPeriods bounds how many periods one request may span.
+const maxStatsPeriods = 400
+
+// defaultStatsPeriods is how many periods, up to and including the current
+// one, are returned when no start date is given.
+const defaultStatsPeriods = 12
+
+// truncateToPeriod returns the first day of the period holding date, weeks
+// starting on Monday as in date_trunc.
+func truncateToPeriod(date time.Time, period string) time.Time {
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case "week":
+		return date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+	case "month":
+		return date.AddDate(0, 0, 1-date.Day())
+	case "year":
+		return time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return date
+	}
+}
+
+// addPeriods moves date by n periods.
+func addPeriods(date time.Time, period string, n int) time.Time {
+	switch period {
+	case "week":
+		return date.AddDate(0, 0, 7*n)
+	case "month":
+		return date.AddDate(0, n, 0)
+	case "year":
+		return date.AddDate(n, 0, 0)
+	default:
+		return date.AddDate(0, 0, n)
+	}
+}
+
+// statsSQL totals the expenses of a user per period and group, filling in
+// periods without expenses so that LAG compares each period with the one
+// right before it. %[1]s is the grouping column, %[2]s the table naming the
+// groups and %[3]s is convertedAmountSQL.
+const statsSQL = `WITH periods AS (
+	SELECT generate_series(
+		date_trunc(@period, CAST(@start AS date)),
+		date_trunc(@period, CAST(@end AS date)),
+		('1 ' || @period)::interval
+	)::date AS period_start
+),
+converted AS (
+	SELECT date_trunc(@period, e.date)::date AS period_start,
+		%[1]s AS group_id,
+		%[3]s AS converted
+	FROM expenses e
+	WHERE e.user_id = @user AND e.date >= @start AND e.date <= @end
+),
+groups AS (
+	SELECT DISTINCT group_id FROM converted
+	UNION
+	SELECT NULL::bigint WHERE NOT EXISTS (SELECT 1 FROM converted)
+),
+totals AS (
+	SELECT p.period_start, g.group_id,
+		COALESCE(ROUND(SUM(c.converted)), 0)::bigint AS total,
+		COUNT(c.period_start) AS count,
+		COUNT(c.period_start) FILTER (WHERE c.converted IS NULL) AS unconverted
+	FROM periods p
+	CROSS JOIN groups g
+	LEFT JOIN converted c ON c.period_start = p.period_start AND c.group_id IS NOT DISTINCT FROM g.group_id
+	GROUP BY p.period_start, g.group_id
+),
+deltas AS (
+	SELECT t.*, LAG(t.total) OVER (PARTITION BY t.group_id ORDER BY t.period_start) AS previous
+	FROM totals t
+)
+SELECT d.period_start, d.group_id, n.name AS group_name, d.total, d.count, d.unconverted,
+	d.total - d.previous AS delta,
+	ROUND(100.0 * (d.total - d.previous) / NULLIF(d.previous, 0), 1)::float8 AS delta_percent
+FROM deltas d
+LEFT JOIN %[2]s n ON n.id = d.group_id
+ORDER BY d.period_start, n.name NULLS LAST`
+
+// Stats reports the user's spending per day, week, month or year, optionally
+// split by category or regular expense, in the user's base currency. Each
+// period comes with its change from the previous one. The result is JSON,
+// or an HTML fragment for HTMX requests.
+func (s *Server) Stats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "Failed to parse user id from request context", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+
+	period := query.Get("period")
+	if period == "" {
+		period = "month"
+	}
+	if !slices.Contains(statsPeriods, period) {
+		http.Error(w, "Invalid period", http.StatusBadRequest)
+		return
+	}
+
+	groupBy := query.Get("group")
+	groupColumn, groupTable := "NULL::bigint", "(SELECT NULL::bigint AS id, NULL::text AS name)"
+	if groupBy != "" {
+		group, ok := statsGroups[groupBy]
+		if !ok {
+			http.Error(w, "Invalid group", http.StatusBadRequest)
+			return
+		}
+		groupColumn, groupTable = "e."+group.column, group.table
+	}
+
+	endDate := time.Now()
+	if value := query.Get("end_date"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			http.Error(w, "Invalid end date", http.StatusBadRequest)
+			return
+		}
+		endDate = parsed
+	}
+
+	startDate := addPeriods(truncateToPeriod(endDate, period), period, 1-defaultStatsPeriods)
+	if value := query.Get("start_date"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			http.Error(w, "Invalid start date", http.StatusBadRequest)
+			return
+		}
+		startDate = parsed
+	}
+
+	if endDate.Before(startDate) {
+		http.Error(w, "End date must be after start date", http.StatusBadRequest)
+		return
+	}
+
+	if addPeriods(truncateToPeriod(startDate, period), period, maxStatsPeriods).Before(endDate) {
+		http.Error(w, fmt.Sprintf("At most %d periods can be requested at once", maxStatsPeriods), http.StatusBadRequest)
+		return
+	}
+
+	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		logFailure("User does not exist", err)
+		http.Error(w, "User does not exist", http.StatusUnauthorized)
+		return
+	}
+
+	var rows []struct {
+		PeriodStart  time.Time
+		GroupID      *uint64
+		GroupName    *string
+		Total        int64
+		Count        int64
+		Unconverted  int64
+		Delta        *int64
+		DeltaPercent *float64
+	}
+	err := s.DB.Raw(
+		fmt.Sprintf(statsSQL, groupColumn, groupTable, convertedAmountSQL),
+		map[string]any{
+			"base":   user.BaseCurrency,
+			"user":   userID,
+			"period": period,
+			"start":  startDate.Format(time.DateOnly),
+			"end":    endDate.Format(time.DateOnly),
+		},
+	).Scan(&rows).Error
+	if err != nil {
+		logFailure("Error while computing statistics", err)
+		http.Error(w, "Error while computing statistics", http.StatusInternalServerError)
+		return
+	}
+
+	stats := templates.Stats{
+		Currency:  user.BaseCurrency,
+		Period:    period,
+		Group:     groupBy,
+		StartDate: startDate.Format(time.DateOnly),
+		EndDate:   endDate.Format(time.DateOnly),
+		Rows:      make([]templates.StatsRow, len(rows)),
+	}
+
+	for i, row := range rows {
+		stats.Rows[i] = templates.StatsRow{
+			PeriodStart:  row.PeriodStart.Format(time.DateOnly),
+			GroupID:      row.GroupID,
+			Total:        model.Money{Minor: row.Total, Currency: user.BaseCurrency},
+			Count:        row.Count,
+			Unconverted:  row.Unconverted,
+			DeltaPercent: row.DeltaPercent,
+		}
+		if row.Delta != nil {
+			stats.Rows[i].Delta = &model.Money{Minor: *row.Delta, Currency: user.BaseCurrency}
+		}
+		if groupBy != "" {
+			stats.Rows[i].GroupName = statsGroups[groupBy].none
+			if row.GroupName != nil {
+				stats.Rows[i].GroupName = *row.GroupName
+			}
+		}
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		templates.StatsChart(stats).Render(r.Context(), w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
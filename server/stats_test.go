@@ -0,0 +1,55 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sergeykhargelia/vct-project/templates"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsByMonth(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(ownerID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "base_currency"}).AddRow(ownerID, "USD"))
+	mock.ExpectQuery(`(?s)WITH periods AS \(.*date_trunc\(\$1, CAST\(\$2 AS date\)\).*LAG\(t.total\) OVER \(PARTITION BY t.group_id ORDER BY t.period_start\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"period_start", "group_id", "group_name", "total", "count", "unconverted", "delta", "delta_percent"}).
+			AddRow(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), nil, nil, 2000, 2, 0, nil, nil).
+			AddRow(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), nil, nil, 3000, 3, 1, 1000, 50.0))
+
+	req := newAuthenticatedRequest(http.MethodGet, "/stats?start_date=2026-01-01&end_date=2026-02-28", ownerID, nil, nil)
+	w := httptest.NewRecorder()
+	s.Stats(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var stats templates.Stats
+	if assert.NoError(t, json.NewDecoder(w.Body).Decode(&stats)) && assert.Len(t, stats.Rows, 2) {
+		assert.Equal(t, "month", stats.Period)
+		assert.Equal(t, "2026-02-01", stats.Rows[1].PeriodStart)
+		assert.Equal(t, "30.00", stats.Rows[1].Total.Decimal())
+		assert.Nil(t, stats.Rows[0].Delta)
+		assert.Equal(t, int64(1000), stats.Rows[1].Delta.Minor)
+		assert.Equal(t, 50.0, *stats.Rows[1].DeltaPercent)
+	}
+}
+
+func TestStatsRejectsUnknownGrouping(t *testing.T) {
+	s, mock := initTestServer(t)
+
+	for _, target := range []string{"/stats?period=quarter", "/stats?group=tag"} {
+		req := newAuthenticatedRequest(http.MethodGet, target, ownerID, nil, nil)
+		w := httptest.NewRecorder()
+		s.Stats(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, target)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,50 @@
+package templates
+
+import (
+	"fmt"
+
+	"github.com/sergeykhargelia/vct-project/model"
+)
+
+// BudgetStatus is how a budget stands in Month: what has been recorded so far
+// plus what the active regular expenses are still going to charge until the
+// end of the month, both converted into the currency of Amount. Unconverted
+// counts expenses and payments left out because no exchange rate was known.
+type BudgetStatus struct {
+	ID           uint64
+	CategoryID   *uint64
+	CategoryName string
+	Amount       model.Money
+	Thresholds   string
+	Month        string
+	Recorded     model.Money
+	Forecast     model.Money
+	Unconverted  int64
+}
+
+// Projected is the spending the month is heading for.
+func (b BudgetStatus) Projected() model.Money {
+	return model.Money{Minor: b.Recorded.Minor + b.Forecast.Minor, Currency: b.Amount.Currency}
+}
+
+// Percent is the projected spending as a percentage of the budget.
+func (b BudgetStatus) Percent() float64 {
+	if b.Amount.Minor <= 0 {
+		return 0
+	}
+	return 100 * float64(b.Projected().Minor) / float64(b.Amount.Minor)
+}
+
+// Title names what the budget covers.
+func (b BudgetStatus) Title() string {
+	if b.CategoryID == nil {
+		return "Overall"
+	}
+	return b.CategoryName
+}
+
+// budgetBarWidth is the width of the progress bar of a budget, as a CSS
+// percentage capped at the full bar.
+func budgetBarWidth(b BudgetStatus) string {
+	return fmt.Sprintf("width: %.1f%%", min(b.Percent(), 100))
+}
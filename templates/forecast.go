@@ -0,0 +1,35 @@
+package templates
+
+import "github.com/sergeykhargelia/vct-project/model"
+
+// Forecast is the upcoming payments of regular expenses from StartDate until
+// EndDate. Totals are converted into Currency at the latest known rates;
+// Unconverted counts payments left out of them because no rate was known.
+type Forecast struct {
+	Currency    string
+	StartDate   string
+	EndDate     string
+	Payments    []ForecastPayment
+	Months      []ForecastMonth
+	Total       model.Money
+	Unconverted int
+}
+
+// ForecastPayment is one upcoming payment. Converted is nil when Amount could
+// not be converted, RunningTotal is the total of the payments so far,
+// including this one.
+type ForecastPayment struct {
+	Date             string
+	RegularExpenseID uint64
+	Name             string
+	Amount           model.Money
+	Converted        *model.Money
+	RunningTotal     model.Money
+	Last             bool
+}
+
+type ForecastMonth struct {
+	Month string
+	Total model.Money
+	Count int
+}
@@ -0,0 +1,26 @@
+package templates
+
+import (
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+)
+
+// StoppedExpense is a cancelled or ended regular expense together with what
+// it cost over its lifetime.
+type StoppedExpense struct {
+	model.RegularExpense
+	Spent Summary
+}
+
+// describeStopped describes why a regular expense is no longer paid, e.g.
+// "cancelled 2026-03-14".
+func describeStopped(e model.RegularExpense) string {
+	if e.Status == model.RegularExpenseEnded {
+		return "ended"
+	}
+	if e.CancelledAt == nil {
+		return "cancelled"
+	}
+	return "cancelled " + e.CancelledAt.Format(time.DateOnly)
+}
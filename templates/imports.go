@@ -0,0 +1,23 @@
+package templates
+
+import "github.com/sergeykhargelia/vct-project/importer"
+
+// ImportResult is the outcome of importing a statement: how many of its Total
+// debits were recorded, the rest having been imported before, and the
+// regular expenses suggested from it. Errors are the rows that could not be
+// read and were left out.
+type ImportResult struct {
+	Total       int
+	Imported    int
+	Errors      []importer.RowError
+	Suggestions []importer.Suggestion
+}
+
+// Skipped is how many debits had been imported before.
+func (r ImportResult) Skipped() int {
+	return r.Total - r.Imported
+}
+
+// dateFormatNames are the keys of importer.DateFormats in the order they are
+// offered.
+var dateFormatNames = []string{"YYYY-MM-DD", "DD.MM.YYYY", "DD/MM/YYYY", "MM/DD/YYYY"}
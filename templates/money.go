@@ -0,0 +1,27 @@
+package templates
+
+import "github.com/sergeykhargelia/vct-project/model"
+
+func currencySymbol(code string) string {
+	return model.CurrencySymbol(code)
+}
+
+// formatMoney formats an amount for display, e.g. "299.99 $".
+func formatMoney(m model.Money) string {
+	return m.Decimal() + " " + model.CurrencySymbol(m.Currency)
+}
+
+// Summary is the total spent over a period, converted into Currency.
+// Unconverted counts expenses left out because no exchange rate was known.
+type Summary struct {
+	Currency    string
+	StartDate   string
+	EndDate     string
+	Total       int64
+	Count       int64
+	Unconverted int64
+}
+
+func (s Summary) TotalMoney() model.Money {
+	return model.Money{Minor: s.Total, Currency: s.Currency}
+}
@@ -0,0 +1,75 @@
+package templates
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sergeykhargelia/vct-project/model"
+	"github.com/sergeykhargelia/vct-project/recurrence"
+)
+
+type recurrencePreset struct {
+	Rule  string
+	Title string
+}
+
+// recurrencePresets are the rules offered in expense forms. Any other rule
+// can be entered by hand.
+var recurrencePresets = []recurrencePreset{
+	{"FREQ=DAILY", "Daily"},
+	{"FREQ=WEEKLY", "Weekly"},
+	{"FREQ=WEEKLY;INTERVAL=2", "Every 2 weeks"},
+	{"FREQ=MONTHLY;SKIP=BACKWARD", "Monthly"},
+	{"FREQ=MONTHLY;BYMONTHDAY=15,-1", "15th and last day of the month"},
+	{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", "Last business day of the month"},
+	{"FREQ=MONTHLY;INTERVAL=3;SKIP=BACKWARD", "Quarterly"},
+	{"FREQ=YEARLY;SKIP=BACKWARD", "Yearly"},
+}
+
+// describeRecurrence describes a stored rule, falling back to the rule itself
+// if it cannot be parsed.
+func describeRecurrence(rule string) string {
+	parsed, err := recurrence.Parse(rule)
+	if err != nil {
+		return rule
+	}
+	return parsed.Describe()
+}
+
+// describeLimits describes when a regular expense ends, e.g.
+// "ends 2026-12-31" or "payment 3 of 12".
+func describeLimits(e model.RegularExpense) string {
+	var parts []string
+	if e.MaxOccurrences != nil {
+		parts = append(parts, fmt.Sprintf("payment %d of %d", e.OccurrenceCount+1, *e.MaxOccurrences))
+	}
+	if e.EndDate != nil {
+		parts = append(parts, "ends "+model.DateOnly(*e.EndDate))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func optionalDate(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return model.DateOnly(*value)
+}
+
+func optionalCount(value *uint) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*value), 10)
+}
+
+// describePause describes the pause window of a regular expense, e.g.
+// "paused from 2026-03-01 until 2026-06-01".
+func describePause(e model.RegularExpense) string {
+	text := "paused from " + optionalDate(e.PausedFrom)
+	if e.PausedUntil != nil {
+		text += " until " + optionalDate(e.PausedUntil)
+	}
+	return text
+}
@@ -0,0 +1,86 @@
+package templates
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sergeykhargelia/vct-project/model"
+)
+
+// Stats is spending per period, optionally split into groups, converted into
+// Currency.
+type Stats struct {
+	Currency  string
+	Period    string
+	Group     string
+	StartDate string
+	EndDate   string
+	Rows      []StatsRow
+}
+
+// StatsRow is the spending of one group over one period. Delta and
+// DeltaPercent compare it with the previous period of the same group and are
+// nil for the first period, DeltaPercent also when nothing was spent in the
+// previous one.
+type StatsRow struct {
+	PeriodStart  string
+	GroupID      *uint64
+	GroupName    string
+	Total        model.Money
+	Count        int64
+	Unconverted  int64
+	Delta        *model.Money
+	DeltaPercent *float64
+}
+
+// maxTotal is the largest total of any row, used to scale bars.
+func (s Stats) maxTotal() int64 {
+	var total int64
+	for _, row := range s.Rows {
+		total = max(total, row.Total.Minor)
+	}
+	return total
+}
+
+// barWidth is the width of the bar of a row, as a CSS percentage.
+func barWidth(s Stats, row StatsRow) string {
+	top := s.maxTotal()
+	if top <= 0 || row.Total.Minor <= 0 {
+		return "width: 0%"
+	}
+	return fmt.Sprintf("width: %.1f%%", 100*float64(row.Total.Minor)/float64(top))
+}
+
+// periodLabel formats the start of a period for display, e.g. "Mar 2026".
+func periodLabel(period, start string) string {
+	date, err := time.Parse(time.DateOnly, start)
+	if err != nil {
+		return start
+	}
+	switch period {
+	case "month":
+		return date.Format("Jan 2006")
+	case "year":
+		return date.Format("2006")
+	case "week":
+		return "Week of " + date.Format("Jan 2")
+	default:
+		return date.Format("Jan 2, 2006")
+	}
+}
+
+// describeDelta formats the change from the previous period, e.g.
+// "+12.50 $ (+8.3%)".
+func describeDelta(row StatsRow) string {
+	if row.Delta == nil {
+		return ""
+	}
+	text := formatMoney(*row.Delta)
+	if row.Delta.Minor > 0 {
+		text = "+" + text
+	}
+	if row.DeltaPercent != nil {
+		text += fmt.Sprintf(" (%+.1f%%)", *row.DeltaPercent)
+	}
+	return text
+}
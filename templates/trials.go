@@ -0,0 +1,16 @@
+package templates
+
+import "github.com/sergeykhargelia/vct-project/model"
+
+// splitTrials separates regular expenses that are still in a trial from the
+// rest, keeping their order.
+func splitTrials(expenses []model.RegularExpense) (trials, others []model.RegularExpense) {
+	for _, expense := range expenses {
+		if expense.TrialEndsOn != nil {
+			trials = append(trials, expense)
+		} else {
+			others = append(others, expense)
+		}
+	}
+	return trials, others
+}